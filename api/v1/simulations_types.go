@@ -2,16 +2,26 @@ package v1
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 )
 
 type SimStatus string
 
 const (
-	SimulationRunning SimStatus = "Running"
-	SimulationFailed  SimStatus = "Failed"
-	SimulationSucceed SimStatus = "Succeed"
-	SimulationPending SimStatus = "Pending"
+	SimulationRunning   SimStatus = "Running"
+	SimulationFailed    SimStatus = "Failed"
+	SimulationSucceed   SimStatus = "Succeed"
+	SimulationPending   SimStatus = "Pending"
+	SimulationSuspended SimStatus = "Suspended"
+	SimulationCancelled SimStatus = "Cancelled"
+	// SimulationNondeterministic marks the runs of a seed which ended in
+	// different states.
+	SimulationNondeterministic SimStatus = "Nondeterministic"
+	// SimulationSkipped marks the stages which did not run because a
+	// previous stage did not succeed.
+	SimulationSkipped SimStatus = "Skipped"
 )
 
 // SimulationSpec defines the desired state of Simulation
@@ -23,18 +33,219 @@ type SimulationSpec struct {
 	// Specifies simulation parameters
 	// +optional
 	Config ConfigSpec `json:"config,omitempty"`
+
+	// Runs the seeds for every combination of the values listed, which
+	// override the target version and config.
+	// +optional
+	Matrix *MatrixSpec `json:"matrix,omitempty"`
+
+	// Runs each seed across an upgrade: the simulation runs at the target
+	// version and exports its state, then continues at the upgraded version
+	// from the exported state, in a second job.
+	// +optional
+	Upgrade *UpgradeSpec `json:"upgrade,omitempty"`
+
+	// Stages run in order by the job of each seed, once the repository is
+	// cloned and its dependencies downloaded. The simulation runs as the
+	// stage named simulate, which takes no image nor command, or before the
+	// other stages if it is not listed. Stages share the workspace, and a
+	// stage runs only if the previous one succeeded.
+	// +optional
+	Pipeline []PipelineStage `json:"pipeline,omitempty"`
+
+	// Specifies how the artifacts uploaded by the simulation are handled
+	// +optional
+	Artifacts ArtifactsSpec `json:"artifacts,omitempty"`
+
+	// Suspends the simulation: no new jobs are created while set. Once unset,
+	// only the seeds which did not run or were interrupted are run.
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+
+	// Whether running jobs are deleted when the simulation is suspended, to
+	// be run again once it is resumed. Otherwise they run to completion.
+	// +optional
+	DeleteRunningOnSuspend bool `json:"deleteRunningOnSuspend,omitempty"`
+
+	// Cancels the simulation: unfinished jobs are terminated and no new jobs
+	// are created. The simulation ends up Cancelled.
+	// +optional
+	Cancel bool `json:"cancel,omitempty"`
+}
+
+// MatrixSpec specifies the values of the cross product run by the simulation.
+// Each combination, or cell, runs every seed in separate jobs.
+type MatrixSpec struct {
+	// The target versions to run.
+	// +optional
+	Versions []string `json:"versions,omitempty"`
+
+	// The numbers of blocks to run.
+	// +optional
+	Blocks []int `json:"blocks,omitempty"`
+
+	// The block sizes to run.
+	// +optional
+	BlockSizes []int `json:"blockSizes,omitempty"`
+
+	// The block periods to run.
+	// +optional
+	Periods []int `json:"periods,omitempty"`
+}
+
+// UpgradeSpec specifies how simulations continue after an upgrade
+type UpgradeSpec struct {
+	// The version of the target repository upgraded to.
+	// +kubebuilder:validation:MinLength=1
+	Version string `json:"version"`
+
+	// For how many blocks the simulation runs after the upgrade. Defaults
+	// to the blocks of the simulation config.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	Blocks int `json:"blocks,omitempty"`
+
+	// The test run after the upgrade. Defaults to the test of the simulation config.
+	// +optional
+	Test string `json:"test,omitempty"`
+
+	// The name of the upgrade handler to apply to the exported state, passed
+	// to the test run after the upgrade with -UpgradeName. The test must
+	// define the flag.
+	// +optional
+	UpgradeName string `json:"upgradeName,omitempty"`
+}
+
+// PipelineStage specifies a step run for each seed
+type PipelineStage struct {
+	// The name of the stage.
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +kubebuilder:validation:MaxLength=50
+	Name string `json:"name"`
+
+	// The image the stage runs in, which must provide sh. Defaults to golang.
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// The command run by the stage from the workspace, where the repository
+	// is checked out. The seed is available in $SEED and, when artifacts are
+	// enabled, the prefix of the seed artifacts in $ARTIFACTS_PREFIX.
+	// Required by every stage but simulate.
+	// +optional
+	Command []string `json:"command,omitempty"`
+
+	// The compute resources required by the stage.
+	// +optional
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// ArtifactsSpec specifies how the logs and artifacts uploaded by the simulation are handled
+type ArtifactsSpec struct {
+	// Specifies for how long artifacts are kept. By default they are kept forever.
+	// +optional
+	Retention RetentionSpec `json:"retention,omitempty"`
+
+	// A secret in the namespace of the simulation holding the S3_ACCESS_KEY_ID
+	// and S3_SECRET_ACCESS_KEY used by simulation pods to upload artifacts.
+	// Without it, pods authenticate with the credentials of their service
+	// account, e.g. through IAM roles for service accounts.
+	// +optional
+	SecretRef *corev1.LocalObjectReference `json:"secretRef,omitempty"`
+
+	// The service account simulation pods run as.
+	// +optional
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+}
+
+// RetentionSpec specifies for how long artifacts are kept
+type RetentionSpec struct {
+	// The number of days after which artifacts are deleted, whether or not
+	// the simulation still exists.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	Days int `json:"days,omitempty"`
+
+	// Whether artifacts are deleted along with the simulation. Otherwise the
+	// artifacts of a deleted simulation are tagged with a deleted.json object.
+	// +optional
+	DeleteWithSimulation bool `json:"deleteWithSimulation,omitempty"`
+}
+
+// SimulationMode is the kind of simulation run.
+// +kubebuilder:validation:Enum=fullApp;importExport;afterImport;nondeterminism;benchmark
+type SimulationMode string
+
+const (
+	// FullAppMode runs the full application simulation.
+	FullAppMode SimulationMode = "fullApp"
+	// ImportExportMode exports the state at the end of the simulation, imports
+	// it into a new application and compares both stores.
+	ImportExportMode SimulationMode = "importExport"
+	// AfterImportMode runs the simulation again from the exported state.
+	AfterImportMode SimulationMode = "afterImport"
+	// NondeterminismMode runs the simulation several times for each seed and
+	// compares the resulting app hashes.
+	NondeterminismMode SimulationMode = "nondeterminism"
+	// BenchmarkMode runs the simulation as a benchmark.
+	BenchmarkMode SimulationMode = "benchmark"
+)
+
+// DeterminismSpec specifies how simulations are checked for non-determinism
+type DeterminismSpec struct {
+	// The number of times each seed is run, in separate jobs. Seeds whose
+	// runs export different states are marked Nondeterministic. Only modes
+	// exporting the state can be replicated.
+	// +kubebuilder:validation:Minimum=1
+	Replicas int `json:"replicas"`
+
+	// The node architectures the replicas run on, in turn, e.g. amd64 and arm64.
+	// +optional
+	Architectures []string `json:"architectures,omitempty"`
+}
+
+// BenchmarkOptions specifies how benchmarks are run and compared
+type BenchmarkOptions struct {
+	// Whether memory allocations are reported, with -benchmem.
+	// +optional
+	Mem bool `json:"mem,omitempty"`
+
+	// Whether a CPU profile is written, as with profiling.cpu.
+	// +optional
+	CPUProfile bool `json:"cpuProfile,omitempty"`
+
+	// Whether a memory profile is written, as with profiling.memory.
+	// +optional
+	MemProfile bool `json:"memProfile,omitempty"`
+
+	// The name of an earlier simulation, in the same namespace, whose
+	// benchmark results are compared with the results of this simulation
+	// once both finished.
+	// +optional
+	BaselineRef string `json:"baselineRef,omitempty"`
+
+	// The increase of a metric, in percent, over which a significant change
+	// from the baseline is a regression, failing the simulation.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:default=5
+	MaxRegression *int `json:"maxRegression,omitempty"`
 }
 
 // ConfigSpec specifies the target package to run simulations for
 type ConfigSpec struct {
-	// The name of the test to run.
+	// The kind of simulation to run, which determines the default test, the
+	// flags it is run with and how its result is interpreted. Defaults to
+	// benchmark if benchmark is set, and to fullApp otherwise.
+	// +optional
+	Mode SimulationMode `json:"mode,omitempty"`
+
+	// The name of the test to run. Defaults to the test of the mode.
 	// +optional
 	// +kubebuilder:validation:MinLength=1
-	// +kubebuilder:default=TestFullAppSimulation
 	Test string `json:"test,omitempty"`
 
 	// Specifies whether the simulation should run as a test
-	// or as a benchmark
+	// or as a benchmark. Superseded by mode.
 	// +optional
 	// +kubebuilder:default=false
 	Benchmark bool `json:"benchmark"`
@@ -63,12 +274,46 @@ type ConfigSpec struct {
 	// +kubebuilder:default="24h"
 	Timeout string `json:"timeout,omitempty"`
 
-	// Seeds to run simulations for.
+	// Wall-clock deadline of each job, including the time its pod is pending,
+	// and of the simulation as a whole, since its creation. Unfinished jobs
+	// are terminated once it is exceeded.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^0*[1-9][0-9]*(s|m|h)$`
+	ActiveDeadline string `json:"activeDeadline,omitempty"`
+
+	// Deadline for the init containers of each job, which clone the repository,
+	// download dependencies and prepare the genesis, since the pod is created.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^0*[1-9][0-9]*(s|m|h)$`
+	SetupDeadline string `json:"setupDeadline,omitempty"`
+
+	// Time after which the jobs of finished simulations are deleted, once
+	// their logs were backed up. Their status is kept.
+	// +optional
+	// +kubebuilder:validation:Pattern=\d+(s|m|h)
+	TTLAfterFinished string `json:"ttlAfterFinished,omitempty"`
+
+	// Specifies which jobs of finished simulations are deleted. When set
+	// without ttlAfterFinished, jobs are deleted as soon as they finish.
+	// +optional
+	JobRetention *JobRetentionSpec `json:"jobRetention,omitempty"`
+
+	// Seeds to run simulations for. Ignored when a seed strategy is set.
 	// +optional
 	// +kubebuilder:validation:MinItems=1
 	// +kubebuilder:default={"1","2","4","7","32","123","124","582","1893","2989","3012","4728","37827","981928","87821","891823782","989182","89182391","11","22","44","77","99","2020","3232","123123","124124","582582","18931893","29892989","30123012","47284728","7601778","8090485","977367484","491163361","424254581","673398983","9071117693009442039","5577006791947779410","4037200794235010051","2775422040480279449","894385949183117216"}
 	Seeds []string `json:"seeds,omitempty"`
 
+	// Generates the seeds to run simulations for, instead of listing them.
+	// The generated seeds are recorded in status.
+	// +optional
+	SeedStrategy *SeedStrategy `json:"seedStrategy,omitempty"`
+
+	// Runs each seed several times to check that the simulation is
+	// deterministic. Requires a mode which exports the simulation state.
+	// +optional
+	Determinism *DeterminismSpec `json:"determinism,omitempty"`
+
 	// Resources describes the desired compute resource requirements for each simulation job.
 	// +optional
 	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
@@ -76,6 +321,93 @@ type ConfigSpec struct {
 	// Genesis specifies the genesis to be provided to the simulation.
 	// +optional
 	Genesis *GenesisSpec `json:"genesis,omitempty"`
+
+	// Specifies how benchmarks are run and compared, in benchmark mode.
+	// +optional
+	BenchmarkOptions *BenchmarkOptions `json:"benchmarkOptions,omitempty"`
+
+	// Specifies the profiles written by the simulation and uploaded once it ends.
+	// +optional
+	Profiling *ProfilingSpec `json:"profiling,omitempty"`
+}
+
+// ProfilingSpec specifies the profiles written by the simulation. Profiles
+// are uploaded with the artifacts, which must be enabled in the controller,
+// and linked from the status of each job.
+type ProfilingSpec struct {
+	// Whether a CPU profile is written, with -cpuprofile.
+	// +optional
+	CPU bool `json:"cpu,omitempty"`
+
+	// Whether a memory profile is written, with -memprofile.
+	// +optional
+	Memory bool `json:"memory,omitempty"`
+
+	// Whether a goroutine blocking profile is written, with -blockprofile.
+	// +optional
+	Block bool `json:"block,omitempty"`
+
+	// Whether an execution trace is written, with -trace.
+	// +optional
+	Trace bool `json:"trace,omitempty"`
+}
+
+type SeedStrategyType string
+
+const (
+	// RandomSeeds generates count seeds from a master seed.
+	RandomSeeds SeedStrategyType = "random"
+	// RangeSeeds generates every seed from start to end.
+	RangeSeeds SeedStrategyType = "range"
+	// PreviousFailuresSeeds uses the seeds that failed in another simulation.
+	PreviousFailuresSeeds SeedStrategyType = "fromPreviousFailures"
+)
+
+// SeedStrategy specifies how seeds are generated
+type SeedStrategy struct {
+	// The type of strategy.
+	// +kubebuilder:validation:Enum=random;range;fromPreviousFailures
+	Type SeedStrategyType `json:"type"`
+
+	// The number of seeds to generate, for random.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	Count int `json:"count,omitempty"`
+
+	// The master seed from which seeds are generated, for random. A master
+	// seed is picked, and recorded in status, when not provided.
+	// +optional
+	MasterSeed *int64 `json:"masterSeed,omitempty"`
+
+	// The first seed, for range.
+	// +optional
+	Start int64 `json:"start,omitempty"`
+
+	// The last seed, inclusive, for range.
+	// +optional
+	End int64 `json:"end,omitempty"`
+
+	// The name of a simulation in the same namespace whose failed seeds are
+	// run, for fromPreviousFailures. Seeds are taken once it finished.
+	// +optional
+	Simulation string `json:"simulation,omitempty"`
+}
+
+// JobRetentionSpec specifies which jobs of finished simulations are kept
+type JobRetentionSpec struct {
+	// Whether the jobs of failed simulations are kept, e.g. for inspection.
+	// Defaults to true.
+	// +optional
+	KeepFailed *bool `json:"keepFailed,omitempty"`
+
+	// Whether the jobs of succeeded simulations are kept.
+	// +optional
+	KeepSucceeded bool `json:"keepSucceeded,omitempty"`
+
+	// The number of most recently finished jobs which are always kept.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	KeepLast int `json:"keepLast,omitempty"`
 }
 
 // GenesisSpec specifies the genesis to be provided to the simulation.
@@ -87,6 +419,42 @@ type GenesisSpec struct {
 	// Allows specifying a genesis from a URL
 	// +optional
 	FromURL string `json:"fromUrl,omitempty"`
+
+	// Patches to apply, in order, to the genesis before it is provided
+	// to the simulation.
+	// +optional
+	Patches []GenesisPatch `json:"patches,omitempty"`
+}
+
+type GenesisPatchType string
+
+const (
+	// JSONPatch applies a JSON Patch (RFC 6902) document.
+	JSONPatch GenesisPatchType = "jsonPatch"
+	// MergePatch applies a JSON Merge Patch (RFC 7386) document.
+	MergePatch GenesisPatchType = "mergePatch"
+	// SetChainId replaces the genesis chain_id with value.
+	SetChainId GenesisPatchType = "setChainId"
+	// ScaleVotingPower multiplies the power of every validator by value.
+	ScaleVotingPower GenesisPatchType = "scaleVotingPower"
+	// SetUnbondingTime replaces the staking unbonding time with value.
+	SetUnbondingTime GenesisPatchType = "setUnbondingTime"
+)
+
+// GenesisPatch specifies a transformation to apply to the genesis.
+type GenesisPatch struct {
+	// The type of transformation.
+	// +kubebuilder:validation:Enum=jsonPatch;mergePatch;setChainId;scaleVotingPower;setUnbondingTime
+	Type GenesisPatchType `json:"type"`
+
+	// The patch document, for jsonPatch and mergePatch types.
+	// +optional
+	Patch string `json:"patch,omitempty"`
+
+	// The value for built-in transformations, e.g. a chain-id for setChainId,
+	// a factor for scaleVotingPower or a duration (e.g. 600s) for setUnbondingTime.
+	// +optional
+	Value string `json:"value,omitempty"`
 }
 
 type FromConfigMapConfig struct {
@@ -140,15 +508,171 @@ type SimulationStatus struct {
 	// The number of jobs that is pending.
 	Pending *int `json:"pending"`
 
+	// The number of jobs that are suspended.
+	// +optional
+	Suspended *int `json:"suspended,omitempty"`
+
+	// The number of jobs that failed because of the app.
+	// +optional
+	AppFailures *int `json:"appFailures,omitempty"`
+
+	// The number of jobs that failed because of the infrastructure.
+	// +optional
+	InfrastructureFailures *int `json:"infrastructureFailures,omitempty"`
+
+	// Whether the simulation failed because of the app, when any seed
+	// failed because of it, or only because of the infrastructure.
+	// +optional
+	FailureType FailureType `json:"failureType,omitempty"`
+
 	// Per job simulation status.
 	// +optional
 	JobStatus []JobStatus `json:"jobStatus"`
 
+	// When the first job started.
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// When the last job finished, once every job finished.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// How long the simulation ran, from the start of its first job to the
+	// end of its last job, once every job finished.
+	// +optional
+	Duration *metav1.Duration `json:"duration,omitempty"`
+
+	// When the simulation is expected to complete, according to the rate at
+	// which its jobs finished so far.
+	// +optional
+	EstimatedCompletionTime *metav1.Time `json:"estimatedCompletionTime,omitempty"`
+
 	// Genesis shows genesis information when one is provided in spec
 	// +optional
 	Genesis *GenesisInfo `json:"genesis,omitempty"`
+
+	// The seeds generated according to the seed strategy.
+	// +optional
+	Seeds []string `json:"seeds,omitempty"`
+
+	// The master seed used to generate random seeds.
+	// +optional
+	MasterSeed *int64 `json:"masterSeed,omitempty"`
+
+	// Conditions represent the latest available observations of the simulation state.
+	// +optional
+	Conditions []SimulationCondition `json:"conditions,omitempty"`
+
+	// Manifest summarising every seed, its result and its artifacts, written
+	// once all jobs finished and their artifacts were uploaded.
+	// +optional
+	Manifest *Artifact `json:"manifest,omitempty"`
+
+	// The digest of the contents of the manifest, so that it is written
+	// again when they change.
+	// +optional
+	ManifestDigest string `json:"manifestDigest,omitempty"`
+
+	// Comparison of the benchmark results with the baseline.
+	// +optional
+	BenchmarkComparison *BenchmarkComparison `json:"benchmarkComparison,omitempty"`
+
+	// Resources suggested for the next run of the simulation, according to
+	// the resources used by its seeds.
+	// +optional
+	SuggestedResources *corev1.ResourceRequirements `json:"suggestedResources,omitempty"`
+}
+
+type SimulationConditionType string
+
+const (
+	// GenesisResolved indicates whether the genesis provided in spec was
+	// retrieved and its information reported in status.
+	GenesisResolved SimulationConditionType = "GenesisResolved"
+
+	// SeedsGenerated indicates whether the seeds were generated according to
+	// the seed strategy and recorded in status.
+	SeedsGenerated SimulationConditionType = "SeedsGenerated"
+
+	// DeadlineExceeded indicates that the simulation ran longer than its active deadline.
+	DeadlineExceeded SimulationConditionType = "DeadlineExceeded"
+
+	// BenchmarkRegression indicates whether the benchmark results regressed
+	// from the baseline.
+	BenchmarkRegression SimulationConditionType = "BenchmarkRegression"
+
+	// SpecValid indicates whether the spec is valid, beyond what its schema
+	// checks. Invalid simulations run no jobs.
+	SpecValid SimulationConditionType = "SpecValid"
+
+	// LogBackupFailed indicates that the logs of some containers could not be
+	// backed up. Their jobs are not held up by them.
+	LogBackupFailed SimulationConditionType = "LogBackupFailed"
+)
+
+// SimulationCondition describes the state of a simulation at a certain point.
+type SimulationCondition struct {
+	// Type of the condition.
+	Type SimulationConditionType `json:"type"`
+
+	// Status of the condition, one of True, False or Unknown.
+	Status corev1.ConditionStatus `json:"status"`
+
+	// Last time the condition transitioned from one status to another.
+	// +optional
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+
+	// The reason for the condition's last transition.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// A human readable message indicating details about the transition.
+	// +optional
+	Message string `json:"message,omitempty"`
 }
 
+// JobPhase is a step of the run of a seed by a job.
+// +kubebuilder:validation:Enum=Scheduling;Cloning;DownloadingDeps;Simulating;Uploading;Finished
+type JobPhase string
+
+const (
+	// JobScheduling is waiting for the job pod to be scheduled.
+	JobScheduling JobPhase = "Scheduling"
+	// JobCloning is cloning the target repository.
+	JobCloning JobPhase = "Cloning"
+	// JobDownloadingDeps is downloading go modules and preparing the genesis,
+	// tools and state used by the simulation.
+	JobDownloadingDeps JobPhase = "DownloadingDeps"
+	// JobSimulating is building and running the simulation.
+	JobSimulating JobPhase = "Simulating"
+	// JobUploading is uploading the artifacts and logs of the simulation.
+	JobUploading JobPhase = "Uploading"
+	// JobFinished is done.
+	JobFinished JobPhase = "Finished"
+)
+
+// JobPhaseStatus records when a job entered a phase.
+type JobPhaseStatus struct {
+	// The phase.
+	Phase JobPhase `json:"phase"`
+
+	// When the phase started.
+	StartTime metav1.Time `json:"startTime"`
+}
+
+// FailureType tells failures of the app apart from infrastructure problems.
+// +kubebuilder:validation:Enum=App;Infrastructure
+type FailureType string
+
+const (
+	// AppFailure is a failure of the simulation itself, or of the app to be
+	// checked out, built or to accept the genesis.
+	AppFailure FailureType = "App"
+	// InfrastructureFailure is a failure to run the simulation, e.g. the
+	// pod was evicted or killed for exceeding its memory limit.
+	InfrastructureFailure FailureType = "Infrastructure"
+)
+
 // JobStatus indicates the simulation status per job.
 type JobStatus struct {
 	// The name of the job running the simulation.
@@ -157,14 +681,299 @@ type JobStatus struct {
 	// The seed being run by the simulation.
 	Seed string `json:"seed"`
 
+	// The stage of the seed run by the job, for simulations run in several jobs.
+	// +optional
+	Stage string `json:"stage,omitempty"`
+
+	// The matrix cell the seed is run for.
+	// +optional
+	Cell string `json:"cell,omitempty"`
+
+	// The matrix values of the cell, by parameter name.
+	// +optional
+	Parameters map[string]string `json:"parameters,omitempty"`
+
 	// The status of this job's simulation.
 	Status SimStatus `json:"status"`
+
+	// When the job started.
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// When the job completed or failed.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// How long the job ran, once it finished.
+	// +optional
+	Duration *metav1.Duration `json:"duration,omitempty"`
+
+	// The phase the job is in, more detailed than its status.
+	// +optional
+	Phase JobPhase `json:"phase,omitempty"`
+
+	// The phases the job went through, in order, with the time each started.
+	// +optional
+	Phases []JobPhaseStatus `json:"phases,omitempty"`
+
+	// Why the simulation failed, as interpreted from its output for its mode,
+	// e.g. Nondeterministic, or as reported for the job pod, e.g. OOMKilled.
+	// Also reports why an unfinished job is stuck, e.g. ImagePullBackOff.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// A human readable message detailing the reason.
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// Whether the simulation failed because of the app or the infrastructure.
+	// +optional
+	FailureType FailureType `json:"failureType,omitempty"`
+
+	// Whether the job was deleted after the simulation finished.
+	// +optional
+	JobDeleted bool `json:"jobDeleted,omitempty"`
+
+	// The commit of the target repository checked out for the simulation.
+	// +optional
+	Commit string `json:"commit,omitempty"`
+
+	// The SHA-256 of the state exported at the end of the simulation, when
+	// checking for non-determinism.
+	// +optional
+	StateHash string `json:"stateHash,omitempty"`
+
+	// Artifacts produced by this job's simulation.
+	// +optional
+	Artifacts []Artifact `json:"artifacts,omitempty"`
+
+	// Profiles written by this job's simulation.
+	// +optional
+	Profiles []Artifact `json:"profiles,omitempty"`
+
+	// Whether the artifacts uploaded by the job were looked up, so that
+	// jobs which uploaded none are not looked up again.
+	// +optional
+	ArtifactsCollected bool `json:"artifactsCollected,omitempty"`
+
+	// Progress of the capture of the logs of each container.
+	// +optional
+	Logs []ContainerLogStatus `json:"logs,omitempty"`
+
+	// The benchmark results reported by the simulation.
+	// +optional
+	Benchmarks []BenchmarkResult `json:"benchmarks,omitempty"`
+
+	// The resources used by the simulation container.
+	// +optional
+	Resources *ResourceUsage `json:"resources,omitempty"`
+
+	// The status of each stage of the pipeline run by the job.
+	// +optional
+	PipelineStages []StageStatus `json:"pipelineStages,omitempty"`
+
+	// Whether the logs of every container were uploaded.
+	// +optional
+	LogsBackedUp bool `json:"logsBackedUp,omitempty"`
+
+	// Results of the previous runs of this seed, oldest first.
+	// +optional
+	Attempts []JobAttempt `json:"attempts,omitempty"`
+}
+
+// JobAttempt records the result of a previous run of a seed.
+type JobAttempt struct {
+	// The status of the simulation.
+	Status SimStatus `json:"status"`
+
+	// The UID of the job which ran the attempt. The job is ignored until it
+	// is gone, as it may still be listed after being deleted.
+	// +optional
+	JobUID types.UID `json:"jobUID,omitempty"`
+
+	// The commit of the target repository checked out for the simulation.
+	// +optional
+	Commit string `json:"commit,omitempty"`
+
+	// Artifacts produced by the simulation.
+	// +optional
+	Artifacts []Artifact `json:"artifacts,omitempty"`
+
+	// Profiles written by the simulation.
+	// +optional
+	Profiles []Artifact `json:"profiles,omitempty"`
+
+	// Logs captured from each container.
+	// +optional
+	Logs []ContainerLogStatus `json:"logs,omitempty"`
+}
+
+// ResourceUsage reports the resources used by the simulation container,
+// including building the simulation.
+type ResourceUsage struct {
+	// The peak memory usage of the container.
+	// +optional
+	PeakMemory *resource.Quantity `json:"peakMemory,omitempty"`
+
+	// The CPU time used by the container.
+	// +optional
+	CPUTime *metav1.Duration `json:"cpuTime,omitempty"`
+
+	// The time the container ran for.
+	// +optional
+	WallTime *metav1.Duration `json:"wallTime,omitempty"`
+
+	// Whether the container was killed for exceeding its memory limit, in
+	// which case its peak memory usage is unknown.
+	// +optional
+	OOMKilled bool `json:"oomKilled,omitempty"`
+}
+
+// BenchmarkResult reports the result of a benchmark.
+type BenchmarkResult struct {
+	// The name of the benchmark, without the GOMAXPROCS suffix.
+	Name string `json:"name"`
+
+	// The number of iterations run.
+	Iterations int64 `json:"iterations"`
+
+	// Nanoseconds per iteration.
+	NsPerOp int64 `json:"nsPerOp"`
+
+	// Bytes allocated per iteration, with -benchmem.
+	// +optional
+	BytesPerOp *int64 `json:"bytesPerOp,omitempty"`
+
+	// Allocations per iteration, with -benchmem.
+	// +optional
+	AllocsPerOp *int64 `json:"allocsPerOp,omitempty"`
+}
+
+// BenchmarkComparison reports the changes of benchmark results from a baseline.
+type BenchmarkComparison struct {
+	// The name of the baseline simulation.
+	Baseline string `json:"baseline"`
+
+	// The number of previous attempts of the seeds of this simulation when
+	// it was compared, to compare it again once seeds are run again.
+	// +optional
+	Attempts int `json:"attempts,omitempty"`
+
+	// The number of previous attempts of the seeds of the baseline when it
+	// was compared.
+	// +optional
+	BaselineAttempts int `json:"baselineAttempts,omitempty"`
+
+	// The changes of each metric of each benchmark.
+	// +optional
+	Deltas []BenchmarkDelta `json:"deltas,omitempty"`
+}
+
+// BenchmarkDelta reports the change of a benchmark metric from the baseline,
+// as the mean over the seeds of each simulation.
+type BenchmarkDelta struct {
+	// The name of the benchmark, prefixed by the matrix cell, if any.
+	Name string `json:"name"`
+
+	// The metric compared, e.g. ns/op.
+	Metric string `json:"metric"`
+
+	// The median of the metric in the baseline.
+	Baseline string `json:"baseline"`
+
+	// The median of the metric in this simulation.
+	Current string `json:"current"`
+
+	// The relative change, e.g. +12.50%, or ~ if it is not significant.
+	Delta string `json:"delta"`
+
+	// The p-value of the Mann-Whitney U-test comparing both samples.
+	PValue string `json:"pValue"`
+
+	// Whether the change is a regression.
+	// +optional
+	Regression bool `json:"regression,omitempty"`
+}
+
+// StageStatus reports the status of a pipeline stage.
+type StageStatus struct {
+	// The name of the stage.
+	Name string `json:"name"`
+
+	// The status of the stage.
+	Status SimStatus `json:"status"`
+
+	// The exit code of the stage, once it terminated.
+	// +optional
+	ExitCode *int32 `json:"exitCode,omitempty"`
+
+	// Why the stage failed or was skipped.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+}
+
+// ContainerLogStatus reports the progress of the capture of a container's logs,
+// which are uploaded in chunks while the container runs.
+type ContainerLogStatus struct {
+	// The name of the container.
+	Container string `json:"container"`
+
+	// The number of chunks uploaded so far.
+	Chunks int `json:"chunks"`
+
+	// The timestamp, in RFC3339 with nanoseconds, of the last line uploaded.
+	// Capture resumes after it, e.g. when the operator restarts.
+	// +optional
+	LastTimestamp string `json:"lastTimestamp,omitempty"`
+
+	// The number of lines uploaded with the last timestamp.
+	// +optional
+	LastTimestampLines int `json:"lastTimestampLines,omitempty"`
+
+	// Whether the complete log was uploaded.
+	Complete bool `json:"complete"`
+
+	// The key of the complete log object.
+	// +optional
+	Key string `json:"key,omitempty"`
+
+	// The size in bytes of the complete log object.
+	// +optional
+	Size int64 `json:"size,omitempty"`
+
+	// The hex encoded SHA256 checksum of the complete log object.
+	// +optional
+	Sha256 string `json:"sha256,omitempty"`
+
+	// The error which caused the upload of the complete log to be abandoned,
+	// once the retries were exhausted.
+	// +optional
+	Error string `json:"error,omitempty"`
+}
+
+// Artifact describes a file produced by a simulation and uploaded to the artifact store.
+type Artifact struct {
+	// The name of the artifact, e.g. state.json.
+	Name string `json:"name"`
+
+	// The key of the object holding the artifact.
+	Key string `json:"key"`
+
+	// The URL of the object holding the artifact.
+	URL string `json:"url"`
+
+	// The size in bytes of the object holding the artifact.
+	Size int64 `json:"size"`
 }
 
 // GenesisInfo shows genesis information
 type GenesisInfo struct {
 	ChainId string `json:"chain_id"`
 	Sha256  string `json:"sha256"`
+
+	// The sha256 of the genesis after patches are applied.
+	// +optional
+	PatchedSha256 string `json:"patched_sha256,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -174,6 +983,9 @@ type GenesisInfo struct {
 // +kubebuilder:printcolumn:name="Succeeded",type=integer,JSONPath=`.status.succeeded`
 // +kubebuilder:printcolumn:name="Failed",type=integer,JSONPath=`.status.failed`
 // +kubebuilder:printcolumn:name="Pending",type=integer,JSONPath=`.status.pending`
+// +kubebuilder:printcolumn:name="Duration",type=string,JSONPath=`.status.duration`
+// +kubebuilder:printcolumn:name="ETA",type=date,JSONPath=`.status.estimatedCompletionTime`,priority=1
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // Simulation is the Schema for the simulations API
 type Simulation struct {
@@ -21,16 +21,575 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Artifact) DeepCopyInto(out *Artifact) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Artifact.
+func (in *Artifact) DeepCopy() *Artifact {
+	if in == nil {
+		return nil
+	}
+	out := new(Artifact)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ArtifactsSpec) DeepCopyInto(out *ArtifactsSpec) {
+	*out = *in
+	out.Retention = in.Retention
+	if in.SecretRef != nil {
+		in, out := &in.SecretRef, &out.SecretRef
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ArtifactsSpec.
+func (in *ArtifactsSpec) DeepCopy() *ArtifactsSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ArtifactsSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BenchmarkComparison) DeepCopyInto(out *BenchmarkComparison) {
+	*out = *in
+	if in.Deltas != nil {
+		in, out := &in.Deltas, &out.Deltas
+		*out = make([]BenchmarkDelta, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BenchmarkComparison.
+func (in *BenchmarkComparison) DeepCopy() *BenchmarkComparison {
+	if in == nil {
+		return nil
+	}
+	out := new(BenchmarkComparison)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BenchmarkDelta) DeepCopyInto(out *BenchmarkDelta) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BenchmarkDelta.
+func (in *BenchmarkDelta) DeepCopy() *BenchmarkDelta {
+	if in == nil {
+		return nil
+	}
+	out := new(BenchmarkDelta)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BenchmarkOptions) DeepCopyInto(out *BenchmarkOptions) {
+	*out = *in
+	if in.MaxRegression != nil {
+		in, out := &in.MaxRegression, &out.MaxRegression
+		*out = new(int)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BenchmarkOptions.
+func (in *BenchmarkOptions) DeepCopy() *BenchmarkOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(BenchmarkOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BenchmarkResult) DeepCopyInto(out *BenchmarkResult) {
+	*out = *in
+	if in.BytesPerOp != nil {
+		in, out := &in.BytesPerOp, &out.BytesPerOp
+		*out = new(int64)
+		**out = **in
+	}
+	if in.AllocsPerOp != nil {
+		in, out := &in.AllocsPerOp, &out.AllocsPerOp
+		*out = new(int64)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BenchmarkResult.
+func (in *BenchmarkResult) DeepCopy() *BenchmarkResult {
+	if in == nil {
+		return nil
+	}
+	out := new(BenchmarkResult)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConfigSpec) DeepCopyInto(out *ConfigSpec) {
+	*out = *in
+	if in.JobRetention != nil {
+		in, out := &in.JobRetention, &out.JobRetention
+		*out = new(JobRetentionSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Seeds != nil {
+		in, out := &in.Seeds, &out.Seeds
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.SeedStrategy != nil {
+		in, out := &in.SeedStrategy, &out.SeedStrategy
+		*out = new(SeedStrategy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Determinism != nil {
+		in, out := &in.Determinism, &out.Determinism
+		*out = new(DeterminismSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	in.Resources.DeepCopyInto(&out.Resources)
+	if in.Genesis != nil {
+		in, out := &in.Genesis, &out.Genesis
+		*out = new(GenesisSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.BenchmarkOptions != nil {
+		in, out := &in.BenchmarkOptions, &out.BenchmarkOptions
+		*out = new(BenchmarkOptions)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Profiling != nil {
+		in, out := &in.Profiling, &out.Profiling
+		*out = new(ProfilingSpec)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConfigSpec.
+func (in *ConfigSpec) DeepCopy() *ConfigSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ConfigSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ContainerLogStatus) DeepCopyInto(out *ContainerLogStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ContainerLogStatus.
+func (in *ContainerLogStatus) DeepCopy() *ContainerLogStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ContainerLogStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DeterminismSpec) DeepCopyInto(out *DeterminismSpec) {
+	*out = *in
+	if in.Architectures != nil {
+		in, out := &in.Architectures, &out.Architectures
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DeterminismSpec.
+func (in *DeterminismSpec) DeepCopy() *DeterminismSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DeterminismSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FromConfigMapConfig) DeepCopyInto(out *FromConfigMapConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FromConfigMapConfig.
+func (in *FromConfigMapConfig) DeepCopy() *FromConfigMapConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(FromConfigMapConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GenesisInfo) DeepCopyInto(out *GenesisInfo) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GenesisInfo.
+func (in *GenesisInfo) DeepCopy() *GenesisInfo {
+	if in == nil {
+		return nil
+	}
+	out := new(GenesisInfo)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GenesisPatch) DeepCopyInto(out *GenesisPatch) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GenesisPatch.
+func (in *GenesisPatch) DeepCopy() *GenesisPatch {
+	if in == nil {
+		return nil
+	}
+	out := new(GenesisPatch)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GenesisSpec) DeepCopyInto(out *GenesisSpec) {
+	*out = *in
+	if in.FromConfigMap != nil {
+		in, out := &in.FromConfigMap, &out.FromConfigMap
+		*out = new(FromConfigMapConfig)
+		**out = **in
+	}
+	if in.Patches != nil {
+		in, out := &in.Patches, &out.Patches
+		*out = make([]GenesisPatch, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GenesisSpec.
+func (in *GenesisSpec) DeepCopy() *GenesisSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(GenesisSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JobAttempt) DeepCopyInto(out *JobAttempt) {
+	*out = *in
+	if in.Artifacts != nil {
+		in, out := &in.Artifacts, &out.Artifacts
+		*out = make([]Artifact, len(*in))
+		copy(*out, *in)
+	}
+	if in.Profiles != nil {
+		in, out := &in.Profiles, &out.Profiles
+		*out = make([]Artifact, len(*in))
+		copy(*out, *in)
+	}
+	if in.Logs != nil {
+		in, out := &in.Logs, &out.Logs
+		*out = make([]ContainerLogStatus, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JobAttempt.
+func (in *JobAttempt) DeepCopy() *JobAttempt {
+	if in == nil {
+		return nil
+	}
+	out := new(JobAttempt)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JobPhaseStatus) DeepCopyInto(out *JobPhaseStatus) {
+	*out = *in
+	in.StartTime.DeepCopyInto(&out.StartTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JobPhaseStatus.
+func (in *JobPhaseStatus) DeepCopy() *JobPhaseStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(JobPhaseStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JobRetentionSpec) DeepCopyInto(out *JobRetentionSpec) {
+	*out = *in
+	if in.KeepFailed != nil {
+		in, out := &in.KeepFailed, &out.KeepFailed
+		*out = new(bool)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JobRetentionSpec.
+func (in *JobRetentionSpec) DeepCopy() *JobRetentionSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(JobRetentionSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JobStatus) DeepCopyInto(out *JobStatus) {
+	*out = *in
+	if in.Parameters != nil {
+		in, out := &in.Parameters, &out.Parameters
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Duration != nil {
+		in, out := &in.Duration, &out.Duration
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.Phases != nil {
+		in, out := &in.Phases, &out.Phases
+		*out = make([]JobPhaseStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Artifacts != nil {
+		in, out := &in.Artifacts, &out.Artifacts
+		*out = make([]Artifact, len(*in))
+		copy(*out, *in)
+	}
+	if in.Profiles != nil {
+		in, out := &in.Profiles, &out.Profiles
+		*out = make([]Artifact, len(*in))
+		copy(*out, *in)
+	}
+	if in.Logs != nil {
+		in, out := &in.Logs, &out.Logs
+		*out = make([]ContainerLogStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.Benchmarks != nil {
+		in, out := &in.Benchmarks, &out.Benchmarks
+		*out = make([]BenchmarkResult, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = new(ResourceUsage)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PipelineStages != nil {
+		in, out := &in.PipelineStages, &out.PipelineStages
+		*out = make([]StageStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Attempts != nil {
+		in, out := &in.Attempts, &out.Attempts
+		*out = make([]JobAttempt, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JobStatus.
+func (in *JobStatus) DeepCopy() *JobStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(JobStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MatrixSpec) DeepCopyInto(out *MatrixSpec) {
+	*out = *in
+	if in.Versions != nil {
+		in, out := &in.Versions, &out.Versions
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Blocks != nil {
+		in, out := &in.Blocks, &out.Blocks
+		*out = make([]int, len(*in))
+		copy(*out, *in)
+	}
+	if in.BlockSizes != nil {
+		in, out := &in.BlockSizes, &out.BlockSizes
+		*out = make([]int, len(*in))
+		copy(*out, *in)
+	}
+	if in.Periods != nil {
+		in, out := &in.Periods, &out.Periods
+		*out = make([]int, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MatrixSpec.
+func (in *MatrixSpec) DeepCopy() *MatrixSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(MatrixSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PipelineStage) DeepCopyInto(out *PipelineStage) {
+	*out = *in
+	if in.Command != nil {
+		in, out := &in.Command, &out.Command
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	in.Resources.DeepCopyInto(&out.Resources)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PipelineStage.
+func (in *PipelineStage) DeepCopy() *PipelineStage {
+	if in == nil {
+		return nil
+	}
+	out := new(PipelineStage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProfilingSpec) DeepCopyInto(out *ProfilingSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProfilingSpec.
+func (in *ProfilingSpec) DeepCopy() *ProfilingSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ProfilingSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResourceUsage) DeepCopyInto(out *ResourceUsage) {
+	*out = *in
+	if in.PeakMemory != nil {
+		in, out := &in.PeakMemory, &out.PeakMemory
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.CPUTime != nil {
+		in, out := &in.CPUTime, &out.CPUTime
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.WallTime != nil {
+		in, out := &in.WallTime, &out.WallTime
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceUsage.
+func (in *ResourceUsage) DeepCopy() *ResourceUsage {
+	if in == nil {
+		return nil
+	}
+	out := new(ResourceUsage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RetentionSpec) DeepCopyInto(out *RetentionSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RetentionSpec.
+func (in *RetentionSpec) DeepCopy() *RetentionSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(RetentionSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SeedStrategy) DeepCopyInto(out *SeedStrategy) {
+	*out = *in
+	if in.MasterSeed != nil {
+		in, out := &in.MasterSeed, &out.MasterSeed
+		*out = new(int64)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SeedStrategy.
+func (in *SeedStrategy) DeepCopy() *SeedStrategy {
+	if in == nil {
+		return nil
+	}
+	out := new(SeedStrategy)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Simulation) DeepCopyInto(out *Simulation) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
-	out.Status = in.Status
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Simulation.
@@ -51,6 +610,22 @@ func (in *Simulation) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SimulationCondition) DeepCopyInto(out *SimulationCondition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SimulationCondition.
+func (in *SimulationCondition) DeepCopy() *SimulationCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(SimulationCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SimulationList) DeepCopyInto(out *SimulationList) {
 	*out = *in
@@ -86,6 +661,26 @@ func (in *SimulationList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SimulationSpec) DeepCopyInto(out *SimulationSpec) {
 	*out = *in
+	out.Target = in.Target
+	in.Config.DeepCopyInto(&out.Config)
+	if in.Matrix != nil {
+		in, out := &in.Matrix, &out.Matrix
+		*out = new(MatrixSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Upgrade != nil {
+		in, out := &in.Upgrade, &out.Upgrade
+		*out = new(UpgradeSpec)
+		**out = **in
+	}
+	if in.Pipeline != nil {
+		in, out := &in.Pipeline, &out.Pipeline
+		*out = make([]PipelineStage, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	in.Artifacts.DeepCopyInto(&out.Artifacts)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SimulationSpec.
@@ -101,6 +696,102 @@ func (in *SimulationSpec) DeepCopy() *SimulationSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SimulationStatus) DeepCopyInto(out *SimulationStatus) {
 	*out = *in
+	if in.Running != nil {
+		in, out := &in.Running, &out.Running
+		*out = new(int)
+		**out = **in
+	}
+	if in.Succeeded != nil {
+		in, out := &in.Succeeded, &out.Succeeded
+		*out = new(int)
+		**out = **in
+	}
+	if in.Failed != nil {
+		in, out := &in.Failed, &out.Failed
+		*out = new(int)
+		**out = **in
+	}
+	if in.Pending != nil {
+		in, out := &in.Pending, &out.Pending
+		*out = new(int)
+		**out = **in
+	}
+	if in.Suspended != nil {
+		in, out := &in.Suspended, &out.Suspended
+		*out = new(int)
+		**out = **in
+	}
+	if in.AppFailures != nil {
+		in, out := &in.AppFailures, &out.AppFailures
+		*out = new(int)
+		**out = **in
+	}
+	if in.InfrastructureFailures != nil {
+		in, out := &in.InfrastructureFailures, &out.InfrastructureFailures
+		*out = new(int)
+		**out = **in
+	}
+	if in.JobStatus != nil {
+		in, out := &in.JobStatus, &out.JobStatus
+		*out = make([]JobStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Duration != nil {
+		in, out := &in.Duration, &out.Duration
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.EstimatedCompletionTime != nil {
+		in, out := &in.EstimatedCompletionTime, &out.EstimatedCompletionTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Genesis != nil {
+		in, out := &in.Genesis, &out.Genesis
+		*out = new(GenesisInfo)
+		**out = **in
+	}
+	if in.Seeds != nil {
+		in, out := &in.Seeds, &out.Seeds
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.MasterSeed != nil {
+		in, out := &in.MasterSeed, &out.MasterSeed
+		*out = new(int64)
+		**out = **in
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]SimulationCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Manifest != nil {
+		in, out := &in.Manifest, &out.Manifest
+		*out = new(Artifact)
+		**out = **in
+	}
+	if in.BenchmarkComparison != nil {
+		in, out := &in.BenchmarkComparison, &out.BenchmarkComparison
+		*out = new(BenchmarkComparison)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SuggestedResources != nil {
+		in, out := &in.SuggestedResources, &out.SuggestedResources
+		*out = new(corev1.ResourceRequirements)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SimulationStatus.
@@ -112,3 +803,53 @@ func (in *SimulationStatus) DeepCopy() *SimulationStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StageStatus) DeepCopyInto(out *StageStatus) {
+	*out = *in
+	if in.ExitCode != nil {
+		in, out := &in.ExitCode, &out.ExitCode
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StageStatus.
+func (in *StageStatus) DeepCopy() *StageStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(StageStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TargetSpec) DeepCopyInto(out *TargetSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TargetSpec.
+func (in *TargetSpec) DeepCopy() *TargetSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(TargetSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UpgradeSpec) DeepCopyInto(out *UpgradeSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UpgradeSpec.
+func (in *UpgradeSpec) DeepCopy() *UpgradeSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(UpgradeSpec)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,190 @@
+package simulation
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+	"github.com/allinbits/runsim-operator/internal/s3"
+	"github.com/allinbits/runsim-operator/internal/tools"
+)
+
+// ensureArtifactsSecret creates or updates the secret configuring the access
+// of simulation pods to the artifact store. The credentials of the operator are
+// not shared, pods get theirs from the simulation's secretRef or service account.
+func (r *SimulationReconciler) ensureArtifactsSecret(ctx context.Context, sim *toolsv1.Simulation) error {
+	data := make(map[string][]byte)
+	for k, v := range getPodArtifactsEnv(r.opts) {
+		data[k] = []byte(v)
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      getArtifactsSecretName(sim),
+			Namespace: sim.Namespace,
+			Labels: map[string]string{
+				NameLabelKey: shortenName(sim.Name),
+			},
+		},
+		Data: data,
+	}
+
+	if err := ctrl.SetControllerReference(sim, secret, r.scheme); err != nil {
+		return err
+	}
+
+	current, err := r.clientset.CoreV1().Secrets(sim.Namespace).Get(secret.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = r.clientset.CoreV1().Secrets(sim.Namespace).Create(secret)
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	if !reflect.DeepEqual(current.Data, secret.Data) {
+		current.Data = secret.Data
+		_, err = r.clientset.CoreV1().Secrets(sim.Namespace).Update(current)
+	}
+	return err
+}
+
+// updateJobArtifacts reports the artifacts and profiles uploaded by a finished
+// job in its status.
+func (r *SimulationReconciler) updateJobArtifacts(ctx context.Context, sim *toolsv1.Simulation, job *batchv1.Job) error {
+	// Ignore if job has not finished yet
+	if job.Status.Succeeded == 0 && job.Status.Failed == 0 {
+		return nil
+	}
+
+	status := getJobStatus(sim, job.Name)
+	if status == nil || status.ArtifactsCollected {
+		return nil
+	}
+
+	artifacts, err := r.getUploadedFiles(ctx, sim, status, getArtifactFiles())
+	if err != nil {
+		return err
+	}
+	profiles, err := r.getUploadedFiles(ctx, sim, status, getProfileFiles(sim))
+	if err != nil {
+		return err
+	}
+
+	status.Artifacts = artifacts
+	status.Profiles = profiles
+	status.ArtifactsCollected = true
+	return nil
+}
+
+// getUploadedFiles returns the files uploaded by the job, skipping the files
+// which the simulation did not produce.
+func (r *SimulationReconciler) getUploadedFiles(ctx context.Context, sim *toolsv1.Simulation, status *toolsv1.JobStatus, files []artifactFile) ([]toolsv1.Artifact, error) {
+	var artifacts []toolsv1.Artifact
+	for _, file := range files {
+		name := file.name
+		key := getArtifactKey(sim, status.Cell, status.Seed, file)
+
+		info, err := r.store.Stat(ctx, key)
+		if err == ErrArtifactNotFound {
+			// The simulation did not produce this artifact
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		artifacts = append(artifacts, toolsv1.Artifact{
+			Name: name,
+			Key:  key,
+			URL:  r.store.URL(key),
+			Size: info.Size,
+		})
+	}
+	return artifacts, nil
+}
+
+// artifactFile is a file uploaded once the simulation ends. Files which are
+// not compressed yet, unlike pprof profiles, are uploaded gzip compressed.
+type artifactFile struct {
+	name, path string
+	compressed bool
+}
+
+// getArtifactFiles returns the files uploaded as artifacts by the simulation.
+func getArtifactFiles() []artifactFile {
+	return []artifactFile{
+		{name: stateArtifactName, path: stateExportPath},
+		{name: paramsArtifactName, path: paramsExportPath},
+	}
+}
+
+// getPodArtifactsEnv returns the environment used by the tools in simulation
+// pods to access the artifact store.
+func getPodArtifactsEnv(opts *Options) map[string]string {
+	switch opts.ArtifactStore {
+	case S3ArtifactStore:
+		env := opts.s3Config().Env()
+		delete(env, s3.AccessKeyIdEnv)
+		delete(env, s3.SecretAccessKeyEnv)
+		env[tools.ArtifactStoreEnv] = tools.S3Store
+		return env
+	case FilesystemArtifactStore:
+		return map[string]string{
+			tools.ArtifactStoreEnv: tools.FilesystemStore,
+			tools.ArtifactsDirEnv:  artifactsMountPath,
+		}
+	default:
+		return nil
+	}
+}
+
+func getArtifactsSecretName(sim *toolsv1.Simulation) string {
+	return fmt.Sprintf("%s-artifacts", sim.Name)
+}
+
+// getArtifactsPrefix returns the prefix of the artifacts of the current run of
+// the seed, within its matrix cell. Reruns are stored apart, so that previous
+// attempts are kept.
+func getArtifactsPrefix(sim *toolsv1.Simulation, cell, seed string) string {
+	prefix := getArtifactsRoot(sim.Namespace, sim.Name) + seed
+	if cell != "" {
+		prefix = getArtifactsRoot(sim.Namespace, sim.Name) + cell + "/" + seed
+	}
+	if status := getJobStatus(sim, getJobName(sim, cell, seed)); status != nil && len(status.Attempts) > 0 {
+		prefix += fmt.Sprintf("/attempt-%d", len(status.Attempts))
+	}
+	return prefix
+}
+
+func getArtifactKey(sim *toolsv1.Simulation, cell, seed string, file artifactFile) string {
+	key := fmt.Sprintf("%s/%s", getArtifactsPrefix(sim, cell, seed), file.name)
+	if !file.compressed {
+		key += ".gz"
+	}
+	return key
+}
+
+// getObjectMetadata returns the metadata stored with the objects uploaded for a job.
+func getObjectMetadata(sim *toolsv1.Simulation, status *toolsv1.JobStatus) map[string]string {
+	metadata := map[string]string{
+		seedMetadata:    status.Seed,
+		repoMetadata:    sim.Spec.Target.Repo,
+		versionMetadata: sim.Spec.Target.Version,
+	}
+	if status.Cell != "" {
+		metadata[cellMetadata] = status.Cell
+	}
+	if v, ok := status.Parameters[versionParameter]; ok {
+		metadata[versionMetadata] = v
+	}
+	if status.Commit != "" {
+		metadata[commitMetadata] = status.Commit
+	}
+	return metadata
+}
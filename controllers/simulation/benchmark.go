@@ -0,0 +1,258 @@
+package simulation
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/perf/benchmath"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+)
+
+const (
+	// benchmarkResult prefixes the benchmark lines of the output reported in
+	// the termination message of the simulation container.
+	benchmarkResult = "benchmark"
+
+	// Metrics reported by benchmarks.
+	nsPerOpMetric     = "ns/op"
+	bytesPerOpMetric  = "B/op"
+	allocsPerOpMetric = "allocs/op"
+
+	// benchmarkConfidence is the confidence level of the centers of the
+	// benchmark samples.
+	benchmarkConfidence = 0.95
+
+	// baselineRetryInterval is the interval at which the baseline simulation
+	// is checked until it finished.
+	baselineRetryInterval = time.Minute
+)
+
+var (
+	benchmarkLine  = regexp.MustCompile(`^Benchmark\S*\s+\d+\s`)
+	benchmarkProcs = regexp.MustCompile(`-\d+$`)
+)
+
+// getBenchmarkFlags returns the go test flags for the benchmark options.
+func getBenchmarkFlags(sim *toolsv1.Simulation) string {
+	if o := sim.Spec.Config.BenchmarkOptions; o != nil && o.Mem {
+		return "-benchmem "
+	}
+	return ""
+}
+
+// getBenchmarkCmd returns the command reporting the benchmark results in the
+// output in the termination message of the simulation container.
+func getBenchmarkCmd() string {
+	return fmt.Sprintf("grep -E '%s' %s | sed 's/^/%s=/' >> /dev/termination-log; ",
+		`^Benchmark[^[:space:]]*[[:space:]]+[0-9]+[[:space:]]`, outputPath, benchmarkResult)
+}
+
+// parseBenchmarks parses the benchmark results of a termination message.
+func parseBenchmarks(message string) []toolsv1.BenchmarkResult {
+	var results []toolsv1.BenchmarkResult
+	for _, line := range strings.Split(message, "\n") {
+		line = strings.TrimPrefix(line, benchmarkResult+"=")
+		if !benchmarkLine.MatchString(line) {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		iterations, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		result := toolsv1.BenchmarkResult{
+			Name:       benchmarkProcs.ReplaceAllString(fields[0], ""),
+			Iterations: iterations,
+		}
+
+		// Values are followed by their unit
+		for i := 2; i+1 < len(fields); i += 2 {
+			v, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				continue
+			}
+			n := int64(math.Round(v))
+			switch fields[i+1] {
+			case nsPerOpMetric:
+				result.NsPerOp = n
+			case bytesPerOpMetric:
+				result.BytesPerOp = &n
+			case allocsPerOpMetric:
+				result.AllocsPerOp = &n
+			}
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// getBenchmarkSamples returns the values of each metric of each benchmark
+// over the seeds which succeeded, by benchmark name and metric.
+func getBenchmarkSamples(sim *toolsv1.Simulation) map[string]map[string][]float64 {
+	samples := make(map[string]map[string][]float64)
+	add := func(name, metric string, v float64) {
+		if samples[name] == nil {
+			samples[name] = make(map[string][]float64)
+		}
+		samples[name][metric] = append(samples[name][metric], v)
+	}
+
+	for _, s := range sim.Status.JobStatus {
+		if s.Status != toolsv1.SimulationSucceed {
+			continue
+		}
+		for _, b := range s.Benchmarks {
+			name := b.Name
+			if s.Cell != "" {
+				name = s.Cell + "/" + name
+			}
+			add(name, nsPerOpMetric, float64(b.NsPerOp))
+			if b.BytesPerOp != nil {
+				add(name, bytesPerOpMetric, float64(*b.BytesPerOp))
+			}
+			if b.AllocsPerOp != nil {
+				add(name, allocsPerOpMetric, float64(*b.AllocsPerOp))
+			}
+		}
+	}
+	return samples
+}
+
+// compareBenchmarks compares the benchmark results of the simulation with
+// the baseline. A significant increase of a metric over maxRegression
+// percent is a regression.
+func compareBenchmarks(sim, baseline *toolsv1.Simulation, maxRegression int) *toolsv1.BenchmarkComparison {
+	comparison := &toolsv1.BenchmarkComparison{
+		Baseline:         baseline.Name,
+		Attempts:         getAttemptsCount(sim),
+		BaselineAttempts: getAttemptsCount(baseline),
+	}
+
+	thresholds := benchmath.DefaultThresholds
+	current, old := getBenchmarkSamples(sim), getBenchmarkSamples(baseline)
+	names := make([]string, 0, len(current))
+	for name := range current {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, metric := range []string{nsPerOpMetric, bytesPerOpMetric, allocsPerOpMetric} {
+			x, y := old[name][metric], current[name][metric]
+			if len(x) == 0 || len(y) == 0 {
+				continue
+			}
+
+			// Samples are compared as benchstat does, by their median
+			// and a Mann-Whitney U-test
+			s1, s2 := benchmath.NewSample(x, &thresholds), benchmath.NewSample(y, &thresholds)
+			c1 := benchmath.AssumeNothing.Summary(s1, benchmarkConfidence).Center
+			c2 := benchmath.AssumeNothing.Summary(s2, benchmarkConfidence).Center
+			cmp := benchmath.AssumeNothing.Compare(s1, s2)
+			delta := toolsv1.BenchmarkDelta{
+				Name:     name,
+				Metric:   metric,
+				Baseline: strconv.FormatFloat(c1, 'f', 0, 64),
+				Current:  strconv.FormatFloat(c2, 'f', 0, 64),
+				Delta:    cmp.FormatDelta(c1, c2),
+				PValue:   strconv.FormatFloat(cmp.P, 'f', 3, 64),
+			}
+			if cmp.P < cmp.Alpha && c1 != 0 {
+				delta.Regression = (c2/c1-1)*100 > float64(maxRegression)
+			}
+			comparison.Deltas = append(comparison.Deltas, delta)
+		}
+	}
+	return comparison
+}
+
+// getAttemptsCount returns the number of previous attempts of every seed of
+// the simulation, which grows whenever seeds are run again.
+func getAttemptsCount(sim *toolsv1.Simulation) int {
+	count := 0
+	for _, s := range sim.Status.JobStatus {
+		count += len(s.Attempts)
+	}
+	return count
+}
+
+// updateBenchmarkComparison compares the benchmark results with the baseline
+// once both simulations finished, and fails the simulation when they
+// regressed. They are compared again when seeds of either simulation are run
+// again. It returns the time after which to check the baseline again when it
+// did not finish yet.
+func (r *SimulationReconciler) updateBenchmarkComparison(ctx context.Context, sim *toolsv1.Simulation) (time.Duration, error) {
+	o := sim.Spec.Config.BenchmarkOptions
+	if o == nil || o.BaselineRef == "" || !getSimulationMode(sim).benchmark {
+		return 0, nil
+	}
+
+	if sim.Status.Status != toolsv1.SimulationSucceed && sim.Status.Status != toolsv1.SimulationFailed {
+		return 0, nil
+	}
+
+	var baseline toolsv1.Simulation
+	err := r.Get(ctx, types.NamespacedName{Namespace: sim.Namespace, Name: o.BaselineRef}, &baseline)
+	found := err == nil
+	if err != nil && !errors.IsNotFound(err) {
+		return 0, err
+	}
+
+	// The comparison is kept if the baseline is deleted afterwards
+	c := sim.Status.BenchmarkComparison
+	if c == nil || c.Baseline != o.BaselineRef || c.Attempts != getAttemptsCount(sim) ||
+		found && c.BaselineAttempts != getAttemptsCount(&baseline) {
+		sim.Status.BenchmarkComparison = nil
+		if !found {
+			setCondition(sim, toolsv1.BenchmarkRegression, corev1.ConditionUnknown, "BaselineNotFound",
+				fmt.Sprintf("simulation %s not found", o.BaselineRef))
+			return 0, nil
+		}
+
+		switch baseline.Status.Status {
+		case toolsv1.SimulationSucceed, toolsv1.SimulationFailed:
+		case toolsv1.SimulationCancelled, toolsv1.SimulationSuspended:
+			// The baseline does not finish unless it is resumed
+			setCondition(sim, toolsv1.BenchmarkRegression, corev1.ConditionUnknown, "BaselineNotComparable",
+				fmt.Sprintf("simulation %s is %s", o.BaselineRef, strings.ToLower(string(baseline.Status.Status))))
+			return 0, nil
+		default:
+			setCondition(sim, toolsv1.BenchmarkRegression, corev1.ConditionUnknown, "BaselineNotFinished",
+				fmt.Sprintf("waiting for simulation %s to finish", o.BaselineRef))
+			return baselineRetryInterval, nil
+		}
+
+		maxRegression := DefaultMaxRegression
+		if o.MaxRegression != nil {
+			maxRegression = *o.MaxRegression
+		}
+		sim.Status.BenchmarkComparison = compareBenchmarks(sim, &baseline, maxRegression)
+	}
+
+	var regressions []string
+	for _, d := range sim.Status.BenchmarkComparison.Deltas {
+		if d.Regression {
+			regressions = append(regressions, fmt.Sprintf("%s %s %s", d.Name, d.Metric, d.Delta))
+		}
+	}
+
+	if len(regressions) > 0 {
+		setCondition(sim, toolsv1.BenchmarkRegression, corev1.ConditionTrue, "Regressed",
+			strings.Join(regressions, ", "))
+		sim.Status.Status = toolsv1.SimulationFailed
+	} else {
+		setCondition(sim, toolsv1.BenchmarkRegression, corev1.ConditionFalse, "NoRegression", "")
+	}
+	return 0, nil
+}
@@ -0,0 +1,159 @@
+package simulation
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+)
+
+func TestParseBenchmarks(t *testing.T) {
+	message := strings.Join([]string{
+		"reason=Panic",
+		"benchmark=BenchmarkFullAppSimulation-8   \t       1\t2512345678 ns/op\t 1024 B/op\t      12 allocs/op",
+		"benchmark=BenchmarkInvariants \t 100\t 0.5 ns/op",
+		"BenchmarkFullAppSimulation",
+	}, "\n")
+
+	results := parseBenchmarks(message)
+	if len(results) != 2 {
+		t.Fatalf("wanted 2 results, got %v", results)
+	}
+	r := results[0]
+	if r.Name != "BenchmarkFullAppSimulation" || r.Iterations != 1 || r.NsPerOp != 2512345678 ||
+		r.BytesPerOp == nil || *r.BytesPerOp != 1024 || r.AllocsPerOp == nil || *r.AllocsPerOp != 12 {
+		t.Fatalf("unexpected result %+v", r)
+	}
+	if r := results[1]; r.Name != "BenchmarkInvariants" || r.Iterations != 100 || r.NsPerOp != 1 || r.BytesPerOp != nil {
+		t.Fatalf("unexpected result %+v", r)
+	}
+}
+
+func TestBenchmarkCmd(t *testing.T) {
+	sim := &toolsv1.Simulation{ObjectMeta: metav1.ObjectMeta{Name: "sim"}}
+	sim.Spec.Config.Mode = toolsv1.BenchmarkMode
+	sim.Spec.Config.Test = "BenchmarkFullAppSimulation"
+	sim.Spec.Config.BenchmarkOptions = &toolsv1.BenchmarkOptions{Mem: true, CPUProfile: true, MemProfile: true}
+
+	opts := defaultOptions()
+	opts.LogBackupEnabled = true
+	job, err := getJobSpec(sim, matrixCell{}, "7", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := job.Spec.Template.Spec.Containers[0].Args[2]
+	for _, s := range []string{"-benchmem", "-cpuprofile " + cpuProfilePath, "-memprofile " + memProfilePath,
+		cpuProfileArtifactName + "=" + cpuProfilePath, benchmarkResult + "=/"} {
+		if !strings.Contains(cmd, s) {
+			t.Fatalf("wanted %s in command, got %s", s, cmd)
+		}
+	}
+
+	// Options are ignored outside of benchmark mode
+	sim.Spec.Config.Mode = toolsv1.FullAppMode
+	if files := getProfileFiles(sim); len(files) != 0 {
+		t.Fatalf("wanted no profiles, got %v", files)
+	}
+}
+
+func TestUpdateBenchmarkComparison(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = toolsv1.AddToScheme(scheme)
+
+	newSim := func(name string, nsPerOp ...int64) *toolsv1.Simulation {
+		sim := &toolsv1.Simulation{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}}
+		sim.Spec.Config.Mode = toolsv1.BenchmarkMode
+		sim.Status.Status = toolsv1.SimulationSucceed
+		for _, n := range nsPerOp {
+			sim.Status.JobStatus = append(sim.Status.JobStatus, toolsv1.JobStatus{
+				Status:     toolsv1.SimulationSucceed,
+				Benchmarks: []toolsv1.BenchmarkResult{{Name: "BenchmarkFullAppSimulation", Iterations: 1, NsPerOp: n}},
+			})
+		}
+		return sim
+	}
+
+	baseline := newSim("baseline", 100, 101, 102, 103, 104)
+	baseline.Status.Status = toolsv1.SimulationRunning
+	r := &SimulationReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme, baseline),
+		log:    zap.New(),
+	}
+
+	maxRegression := 10
+	sim := newSim("sim", 120, 121, 122, 123, 124)
+	sim.Spec.Config.BenchmarkOptions = &toolsv1.BenchmarkOptions{BaselineRef: "baseline", MaxRegression: &maxRegression}
+
+	// The comparison waits for the baseline to finish
+	after, err := r.updateBenchmarkComparison(ctx, sim)
+	if err != nil || after != baselineRetryInterval || sim.Status.BenchmarkComparison != nil {
+		t.Fatalf("wanted to wait for baseline, got %v %v", after, err)
+	}
+
+	// A baseline which does not finish cannot be compared
+	baseline.Status.Status = toolsv1.SimulationCancelled
+	if err := r.Update(ctx, baseline); err != nil {
+		t.Fatal(err)
+	}
+	after, err = r.updateBenchmarkComparison(ctx, sim)
+	if cond := getCondition(sim, toolsv1.BenchmarkRegression); err != nil || after != 0 || cond == nil || cond.Reason != "BaselineNotComparable" {
+		t.Fatalf("wanted comparison to fail, got %v %v %+v", after, err, cond)
+	}
+
+	baseline.Status.Status = toolsv1.SimulationSucceed
+	if err := r.Update(ctx, baseline); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.updateBenchmarkComparison(ctx, sim); err != nil {
+		t.Fatal(err)
+	}
+	c := sim.Status.BenchmarkComparison
+	if c == nil || len(c.Deltas) != 1 || c.Deltas[0].Delta != "+19.61%" || !c.Deltas[0].Regression {
+		t.Fatalf("wanted regression, got %+v", c)
+	}
+	if cond := getCondition(sim, toolsv1.BenchmarkRegression); cond == nil || cond.Status != corev1.ConditionTrue ||
+		sim.Status.Status != toolsv1.SimulationFailed {
+		t.Fatalf("wanted simulation to fail with a regression, got %s %+v", sim.Status.Status, cond)
+	}
+
+	// Changes within the allowed regression do not fail the simulation
+	sim = newSim("sim", 105, 106, 107, 108, 109)
+	sim.Spec.Config.BenchmarkOptions = &toolsv1.BenchmarkOptions{BaselineRef: "baseline", MaxRegression: &maxRegression}
+	if _, err := r.updateBenchmarkComparison(ctx, sim); err != nil {
+		t.Fatal(err)
+	}
+	if d := sim.Status.BenchmarkComparison.Deltas[0]; d.Delta != "+4.90%" || d.Regression || sim.Status.Status != toolsv1.SimulationSucceed {
+		t.Fatalf("wanted no regression, got %+v %s", d, sim.Status.Status)
+	}
+
+	// The comparison is kept until seeds of either simulation run again
+	maxRegression = 0
+	if _, err := r.updateBenchmarkComparison(ctx, sim); err != nil {
+		t.Fatal(err)
+	}
+	if sim.Status.BenchmarkComparison.Deltas[0].Regression {
+		t.Fatalf("wanted the comparison to be kept")
+	}
+
+	// Any significant increase is a regression when none is allowed
+	baseline.Status.JobStatus[0].Attempts = []toolsv1.JobAttempt{{Status: toolsv1.SimulationFailed}}
+	if err := r.Update(ctx, baseline); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.updateBenchmarkComparison(ctx, sim); err != nil {
+		t.Fatal(err)
+	}
+	if c := sim.Status.BenchmarkComparison; c.BaselineAttempts != 1 || !c.Deltas[0].Regression || sim.Status.Status != toolsv1.SimulationFailed {
+		t.Fatalf("wanted the rerun baseline to be compared again, got %+v %s", c, sim.Status.Status)
+	}
+}
@@ -0,0 +1,82 @@
+package simulation
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+)
+
+// cleanupJobs deletes the finished jobs whose TTL expired according to the
+// retention policy, once their logs were backed up, keeping their status. It
+// returns the time after which the next job expires, if any.
+func (r *SimulationReconciler) cleanupJobs(ctx context.Context, sim *toolsv1.Simulation, finished []*batchv1.Job) (time.Duration, error) {
+	config := sim.Spec.Config
+	if config.TTLAfterFinished == "" && config.JobRetention == nil {
+		return 0, nil
+	}
+
+	var ttl time.Duration
+	if config.TTLAfterFinished != "" {
+		var err error
+		if ttl, err = time.ParseDuration(config.TTLAfterFinished); err != nil {
+			return 0, err
+		}
+	}
+
+	retention := toolsv1.JobRetentionSpec{}
+	if config.JobRetention != nil {
+		retention = *config.JobRetention
+	}
+	// Failed jobs are kept unless stated otherwise
+	keepFailed := retention.KeepFailed == nil || *retention.KeepFailed
+
+	// The most recently finished jobs are kept
+	sort.Slice(finished, func(i, j int) bool {
+		return getJobFinishedTime(finished[i]).After(getJobFinishedTime(finished[j]))
+	})
+
+	var requeueAfter time.Duration
+	for i, job := range finished {
+		status := getJobStatus(sim, job.Name)
+		switch {
+		case status == nil,
+			i < retention.KeepLast,
+			keepFailed && isJobFailed(status.Status),
+			retention.KeepSucceeded && status.Status == toolsv1.SimulationSucceed,
+			r.opts.LogBackupEnabled && !status.LogsBackedUp:
+			continue
+		}
+
+		if remaining := ttl - time.Since(getJobFinishedTime(job)); remaining > 0 {
+			if requeueAfter == 0 || remaining < requeueAfter {
+				requeueAfter = remaining
+			}
+			continue
+		}
+
+		r.log.WithValues("simulation", sim.Name).Info("deleting finished job", "seed", status.Seed)
+		if err := r.MaybeDeleteJob(ctx, sim, status.Cell, status.Seed); err != nil {
+			return 0, err
+		}
+		status.JobDeleted = true
+	}
+	return requeueAfter, nil
+}
+
+// getJobFinishedTime returns the time at which the job succeeded or failed.
+func getJobFinishedTime(job *batchv1.Job) time.Time {
+	if job.Status.CompletionTime != nil {
+		return job.Status.CompletionTime.Time
+	}
+	for _, c := range job.Status.Conditions {
+		if c.Type == batchv1.JobFailed && c.Status == corev1.ConditionTrue {
+			return c.LastTransitionTime.Time
+		}
+	}
+	return time.Time{}
+}
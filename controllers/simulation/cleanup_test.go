@@ -0,0 +1,79 @@
+package simulation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+)
+
+func TestCleanupJobs(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	sim := &toolsv1.Simulation{ObjectMeta: metav1.ObjectMeta{Name: "sim", Namespace: "default"}}
+	sim.Spec.Config.TTLAfterFinished = "1h"
+	sim.Spec.Config.JobRetention = &toolsv1.JobRetentionSpec{KeepLast: 1}
+
+	newJob := func(seed string, finishedAgo time.Duration, succeeded bool, backedUp bool) *batchv1.Job {
+		job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: getJobName(sim, "", seed), Namespace: sim.Namespace}}
+		finishedAt := metav1.NewTime(time.Now().Add(-finishedAgo))
+		status := toolsv1.SimulationFailed
+		if succeeded {
+			job.Status.Succeeded = 1
+			job.Status.CompletionTime = &finishedAt
+			status = toolsv1.SimulationSucceed
+		} else {
+			job.Status.Failed = 1
+			job.Status.Conditions = []batchv1.JobCondition{
+				{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, LastTransitionTime: finishedAt},
+			}
+		}
+		sim.Status.JobStatus = append(sim.Status.JobStatus, toolsv1.JobStatus{
+			Name:         job.Name,
+			Seed:         seed,
+			Status:       status,
+			LogsBackedUp: backedUp,
+		})
+		return job
+	}
+
+	jobs := []*batchv1.Job{
+		newJob("1", 2*time.Hour, false, true),
+		newJob("2", 3*time.Hour, true, true),
+		newJob("3", 10*time.Minute, true, true),
+		newJob("4", 4*time.Hour, true, false),
+		newJob("5", 30*time.Minute, true, true),
+	}
+
+	r := &SimulationReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme, jobs[0], jobs[1], jobs[2], jobs[3], jobs[4]),
+		log:    zap.New(),
+		opts:   &Options{LogBackupEnabled: true},
+	}
+
+	requeueAfter, err := r.cleanupJobs(context.Background(), sim, jobs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// 1 failed, 3 is the last finished, 4 logs are not backed up, 5 ttl not expired
+	for _, s := range sim.Status.JobStatus {
+		if s.JobDeleted != (s.Seed == "2") {
+			t.Fatalf("unexpected deletion of seed %s: %v", s.Seed, s.JobDeleted)
+		}
+	}
+
+	if requeueAfter <= 0 || requeueAfter > 30*time.Minute {
+		t.Fatalf("wanted requeue once seed 5 expires, got %v", requeueAfter)
+	}
+}
@@ -0,0 +1,43 @@
+package simulation
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+)
+
+// setCondition adds or updates the condition of the given type, updating
+// its transition time only when the status changes.
+func setCondition(sim *toolsv1.Simulation, condType toolsv1.SimulationConditionType, status corev1.ConditionStatus, reason, message string) {
+	for i, c := range sim.Status.Conditions {
+		if c.Type != condType {
+			continue
+		}
+		if c.Status != status {
+			sim.Status.Conditions[i].LastTransitionTime = metav1.Now()
+		}
+		sim.Status.Conditions[i].Status = status
+		sim.Status.Conditions[i].Reason = reason
+		sim.Status.Conditions[i].Message = message
+		return
+	}
+
+	sim.Status.Conditions = append(sim.Status.Conditions, toolsv1.SimulationCondition{
+		Type:               condType,
+		Status:             status,
+		LastTransitionTime: metav1.Now(),
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// getCondition returns the condition of the given type, if any.
+func getCondition(sim *toolsv1.Simulation, condType toolsv1.SimulationConditionType) *toolsv1.SimulationCondition {
+	for i, c := range sim.Status.Conditions {
+		if c.Type == condType {
+			return &sim.Status.Conditions[i]
+		}
+	}
+	return nil
+}
@@ -15,18 +15,93 @@ const (
 	DefaultPeriod              = 1
 	DefaultTimeout             = "24h"
 	DefaultGenesisConfigMapKey = "genesis.json"
+	DefaultMaxRegression       = 5
 
-	genesisMountPath = "/config"
+	genesisMountPath      = "/config"
+	tmpDir                = "/workspace/.tmp"
+	downloadedGenesisPath = tmpDir + "/genesis.json"
+	patchedGenesisPath    = tmpDir + "/genesis.patched.json"
+	stateExportPath       = tmpDir + "/state.json"
+	paramsExportPath      = tmpDir + "/params.json"
+	outputPath            = tmpDir + "/output.log"
+	stateGenesisPath      = tmpDir + "/genesis.state.json"
+	stagesDir             = tmpDir + "/stages"
+	cpuProfilePath        = tmpDir + "/cpu.pprof"
+	memProfilePath        = tmpDir + "/mem.pprof"
+	blockProfilePath      = tmpDir + "/block.pprof"
+	tracePath             = tmpDir + "/trace.out"
+	toolsMountPath        = "/tools"
+	toolsBinPath          = toolsMountPath + "/runsim"
+	artifactsMountPath    = "/artifacts"
 
 	SeedAnnotation      = "tools.cosmos.network/simulation-seed"
 	LogBackupAnnotation = "tools.cosmos.network/logs-backed-up"
 	NameLabelKey        = "simulation"
 
+	// NameAnnotation holds the name of the simulation running a pod, which
+	// may be shortened in its NameLabelKey label.
+	NameAnnotation = "tools.cosmos.network/simulation"
+
+	// SeedLabelKey and MatrixCellLabelKey hold the seed and matrix cell run
+	// by a job, shortened as job names to fit in label values.
+	SeedLabelKey       = "tools.cosmos.network/seed"
+	MatrixCellLabelKey = "tools.cosmos.network/matrix-cell"
+
+	// nameHashLength is the length of the hash suffixed to shortened names.
+	nameHashLength = 10
+	// cellHashLength is the length of the hash of the values of a matrix
+	// cell suffixed to its name.
+	cellHashLength = 6
+
+	// RerunAnnotation requests the seeds, comma separated, or all failed
+	// seeds, with rerunFailed, of a simulation to be run again.
+	RerunAnnotation = "tools.cosmos.network/rerun"
+	rerunFailed     = "failed"
+
+	// TerminatedAnnotation holds the reason for which the controller
+	// terminated a job before it finished.
+	TerminatedAnnotation = "tools.cosmos.network/terminated"
+
+	// Reasons for terminating jobs.
+	cancelledReason             = "Cancelled"
+	deadlineExceededReason      = "DeadlineExceeded"
+	setupDeadlineExceededReason = "SetupDeadlineExceeded"
+	stageKilledReason           = "StageKilled"
+
+	// ArtifactsFinalizer applies the artifacts retention policy when a simulation is deleted.
+	ArtifactsFinalizer = "tools.cosmos.network/artifacts"
+
 	CASafeToEvictAnnotation = "cluster-autoscaler.kubernetes.io/safe-to-evict"
 
-	simulationContainerName = "simulation"
-	stateContainerName      = "state"
-	paramsContainerName     = "params"
+	simulationContainerName    = "simulation"
+	cloneContainerName         = "clone-repo"
+	goModContainerName         = "go-mod"
+	patchGenesisContainerName  = "patch-genesis"
+	downloadStateContainerName = "download-state"
+
+	stateArtifactName  = "state.json"
+	paramsArtifactName = "params.json"
+
+	cpuProfileArtifactName   = "cpu.pprof"
+	memProfileArtifactName   = "mem.pprof"
+	blockProfileArtifactName = "block.pprof"
+	traceArtifactName        = "trace.out"
+
+	manifestName  = "manifest.json"
+	tombstoneName = "deleted.json"
+
+	// Metadata stored with uploaded logs and artifacts.
+	seedMetadata      = "seed"
+	cellMetadata      = "cell"
+	repoMetadata      = "repo"
+	versionMetadata   = "version"
+	commitMetadata    = "commit"
+	statusMetadata    = "status"
+	startTimeMetadata = "start-time"
+	endTimeMetadata   = "end-time"
+
+	// dateCmd prints the current time in RFC3339.
+	dateCmd = "date -u +%Y-%m-%dT%H:%M:%SZ"
 )
 
 var (
@@ -5,15 +5,16 @@ import (
 	"time"
 
 	"github.com/go-logr/logr"
-	"github.com/minio/minio-go/v7"
-	"github.com/minio/minio-go/v7/pkg/credentials"
 	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
@@ -24,8 +25,10 @@ type SimulationReconciler struct {
 	client.Client
 	log       logr.Logger
 	scheme    *runtime.Scheme
-	clientset *kubernetes.Clientset
-	minio     *minio.Client
+	clientset kubernetes.Interface
+	store     ArtifactStore
+	logs      *logShipper
+	genesis   *genesisResolver
 	opts      *Options
 }
 
@@ -45,23 +48,57 @@ func SetupSimulationReconciler(mgr ctrl.Manager, opts ...Option) error {
 		log:       ctrl.Log.WithName("controllers").WithName("Simulations"),
 		scheme:    mgr.GetScheme(),
 		clientset: clientset,
+		genesis:   newGenesisResolver(ctrl.Log.WithName("genesis")),
 		opts:      options,
 	}
 
+	if err := mgr.Add(r.genesis); err != nil {
+		return err
+	}
+
+	builder := ctrl.NewControllerManagedBy(mgr).
+		For(&toolsv1.Simulation{}).
+		Watches(&source.Kind{Type: &batchv1.Job{}}, &handler.EnqueueRequestForOwner{OwnerType: &toolsv1.Simulation{}}).
+		Watches(&source.Kind{Type: &corev1.Pod{}}, &handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(mapPodToSimulation)}).
+		Watches(&source.Channel{Source: r.genesis.events}, &handler.EnqueueRequestForObject{})
+
 	if options.LogBackupEnabled {
-		r.minio, err = minio.New(options.MinioEndpoint, &minio.Options{
-			Creds:  credentials.NewStaticV4(options.S3AccessKeyId, options.S3SecretAccessKey, ""),
-			Secure: true,
-		})
+		r.store, err = newArtifactStore(options)
 		if err != nil {
 			return err
 		}
+
+		r.logs = newLogShipper(ctrl.Log.WithName("logs"), clientset, r.store)
+		if err := mgr.Add(r.logs); err != nil {
+			return err
+		}
+
+		if err := mgr.Add(&artifactsCollector{
+			log:               ctrl.Log.WithName("artifacts"),
+			client:            mgr.GetClient(),
+			store:             r.store,
+			orphanedRetention: options.OrphanedArtifactsRetention,
+		}); err != nil {
+			return err
+		}
+		builder = builder.Watches(&source.Channel{Source: r.logs.events}, &handler.EnqueueRequestForObject{})
 	}
 
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&toolsv1.Simulation{}).
-		Watches(&source.Kind{Type: &batchv1.Job{}}, &handler.EnqueueRequestForOwner{OwnerType: &toolsv1.Simulation{}}).
-		Complete(&r)
+	return builder.Complete(&r)
+}
+
+// mapPodToSimulation enqueues the simulation running a pod.
+func mapPodToSimulation(obj handler.MapObject) []reconcile.Request {
+	name, ok := obj.Meta.GetAnnotations()[NameAnnotation]
+	if !ok {
+		// Pods created before their simulation was annotated
+		if name, ok = obj.Meta.GetLabels()[NameLabelKey]; !ok {
+			return nil
+		}
+	}
+	return []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Namespace: obj.Meta.GetNamespace(), Name: name}},
+	}
 }
 
 // +kubebuilder:rbac:groups=tools.cosmos.network,resources=simulations,verbs=get;list;watch;create;update;patch;delete
@@ -69,6 +106,7 @@ func SetupSimulationReconciler(mgr ctrl.Manager, opts ...Option) error {
 // +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=batch,resources=jobs/status,verbs=get
 // +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;create;update
 // +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch;update
 // +kubebuilder:rbac:groups="",resources=pods/log,verbs=get;list;watch
 
@@ -87,10 +125,25 @@ func (r *SimulationReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error)
 		}, err
 	}
 
+	// Apply the artifacts retention policy before the simulation is deleted
+	if !sim.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, r.finalizeArtifacts(ctx, &sim)
+	}
+
+	if r.opts.LogBackupEnabled {
+		if updated, err := r.ensureArtifactsFinalizer(ctx, &sim); updated || err != nil {
+			return ctrl.Result{Requeue: true}, err
+		}
+	}
+
 	if r.setSimulationDefaults(&sim) {
 		return ctrl.Result{Requeue: true}, r.Update(ctx, &sim)
 	}
 
+	if updated, err := r.rerunSeeds(ctx, &sim); updated || err != nil {
+		return ctrl.Result{Requeue: true}, err
+	}
+
 	r.log.WithValues("simulation", sim.Name).Info("reconciling")
-	return ctrl.Result{}, r.ReconcileSimulation(ctx, &sim)
+	return r.ReconcileSimulation(ctx, &sim)
 }
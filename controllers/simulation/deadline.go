@@ -0,0 +1,108 @@
+package simulation
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/pointer"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+)
+
+// getTerminationReason returns the reason for which the unfinished jobs of the
+// simulation must be terminated, if any, or the time after which its active
+// deadline is exceeded.
+func getTerminationReason(sim *toolsv1.Simulation) (string, time.Duration, error) {
+	if sim.Spec.Cancel {
+		return cancelledReason, 0, nil
+	}
+
+	if sim.Spec.Config.ActiveDeadline == "" {
+		return "", 0, nil
+	}
+
+	deadline, err := parseDeadline(sim.Spec.Config.ActiveDeadline)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if remaining := deadline - time.Since(sim.CreationTimestamp.Time); remaining > 0 {
+		return "", remaining, nil
+	}
+
+	setCondition(sim, toolsv1.DeadlineExceeded, corev1.ConditionTrue, deadlineExceededReason,
+		fmt.Sprintf("simulation did not finish within %s", deadline))
+	return deadlineExceededReason, 0, nil
+}
+
+// parseDeadline parses a deadline, which must be positive: a zero deadline
+// would fail jobs right away.
+func parseDeadline(s string) (time.Duration, error) {
+	deadline, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if deadline <= 0 {
+		return 0, fmt.Errorf("deadline %s is not positive", s)
+	}
+	return deadline, nil
+}
+
+// getSetupTerminationReason returns whether the init containers of the pod
+// did not finish within the setup deadline or the time remaining until then.
+func getSetupTerminationReason(sim *toolsv1.Simulation, pod *corev1.Pod) (string, time.Duration, error) {
+	if sim.Spec.Config.SetupDeadline == "" || pod == nil || initContainersDone(pod) {
+		return "", 0, nil
+	}
+
+	deadline, err := parseDeadline(sim.Spec.Config.SetupDeadline)
+	if err != nil {
+		return "", 0, err
+	}
+
+	// Pods which are never scheduled have no start time
+	if remaining := deadline - time.Since(pod.CreationTimestamp.Time); remaining > 0 {
+		return "", remaining, nil
+	}
+	return setupDeadlineExceededReason, 0, nil
+}
+
+// terminateJob makes the job fail, recording the reason. Exceeding the job's
+// active deadline makes the job controller kill its pods, while the job is
+// kept so that its logs can be backed up.
+func (r *SimulationReconciler) terminateJob(ctx context.Context, job *batchv1.Job, reason string) error {
+	if _, ok := job.Annotations[TerminatedAnnotation]; ok {
+		return nil
+	}
+
+	r.log.WithValues("job", job.Name).Info("terminating job", "reason", reason)
+	if job.Annotations == nil {
+		job.Annotations = make(map[string]string)
+	}
+	job.Annotations[TerminatedAnnotation] = reason
+	job.Spec.ActiveDeadlineSeconds = pointer.Int64Ptr(1)
+	return r.Update(ctx, job)
+}
+
+func initContainersDone(pod *corev1.Pod) bool {
+	if len(pod.Status.InitContainerStatuses) < len(pod.Spec.InitContainers) {
+		return false
+	}
+	for _, cs := range pod.Status.InitContainerStatuses {
+		if cs.State.Terminated == nil || cs.State.Terminated.ExitCode != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// minRequeue returns the shortest of the non-zero durations.
+func minRequeue(a, b time.Duration) time.Duration {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
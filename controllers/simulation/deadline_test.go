@@ -0,0 +1,97 @@
+package simulation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+)
+
+func TestGetTerminationReason(t *testing.T) {
+	sim := &toolsv1.Simulation{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(time.Now().Add(-time.Hour))}}
+
+	sim.Spec.Config.ActiveDeadline = "2h"
+	reason, remaining, err := getTerminationReason(sim)
+	if err != nil || reason != "" || remaining <= 0 || remaining > time.Hour {
+		t.Fatalf("unexpected result %q %v %v", reason, remaining, err)
+	}
+
+	sim.Spec.Config.ActiveDeadline = "30m"
+	if reason, _, err = getTerminationReason(sim); err != nil || reason != deadlineExceededReason {
+		t.Fatalf("wanted deadline exceeded, got %q %v", reason, err)
+	}
+	if len(sim.Status.Conditions) != 1 || sim.Status.Conditions[0].Type != toolsv1.DeadlineExceeded {
+		t.Fatalf("wanted DeadlineExceeded condition, got %+v", sim.Status.Conditions)
+	}
+
+	sim.Spec.Config.ActiveDeadline = "0s"
+	if _, _, err = getTerminationReason(sim); err == nil {
+		t.Fatalf("wanted zero deadline to be rejected")
+	}
+
+	sim.Spec.Cancel = true
+	if reason, _, err = getTerminationReason(sim); err != nil || reason != cancelledReason {
+		t.Fatalf("wanted cancelled, got %q %v", reason, err)
+	}
+}
+
+func TestGetSetupTerminationReason(t *testing.T) {
+	sim := &toolsv1.Simulation{}
+	sim.Spec.Config.SetupDeadline = "10m"
+
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(time.Now().Add(-time.Hour))}}
+	pod.Spec.InitContainers = []corev1.Container{{Name: cloneContainerName}}
+
+	if reason, _, err := getSetupTerminationReason(sim, pod); err != nil || reason != setupDeadlineExceededReason {
+		t.Fatalf("wanted setup deadline exceeded, got %q %v", reason, err)
+	}
+
+	pod.Status.InitContainerStatuses = []corev1.ContainerStatus{
+		{Name: cloneContainerName, State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{}}},
+	}
+	if reason, _, err := getSetupTerminationReason(sim, pod); err != nil || reason != "" {
+		t.Fatalf("wanted no termination once init containers are done, got %q %v", reason, err)
+	}
+}
+
+func TestTerminateJob(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	sim := &toolsv1.Simulation{ObjectMeta: metav1.ObjectMeta{Name: "sim", Namespace: "default"}}
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{
+		Name:        getJobName(sim, "", "1"),
+		Namespace:   sim.Namespace,
+		Annotations: map[string]string{SeedAnnotation: "1"},
+	}}
+
+	r := &SimulationReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme, job.DeepCopy()),
+		log:    zap.New(),
+	}
+	if err := r.terminateJob(context.Background(), job, cancelledReason); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if job.Spec.ActiveDeadlineSeconds == nil || *job.Spec.ActiveDeadlineSeconds != 1 {
+		t.Fatalf("wanted active deadline to be exceeded, got %v", job.Spec.ActiveDeadlineSeconds)
+	}
+
+	// Jobs which fail after being cancelled are reported as cancelled
+	job.Status.Failed = 1
+	if err := updateJobStatus(sim, matrixCell{}, job); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	updateGlobalStatus(sim)
+	if sim.Status.Status != toolsv1.SimulationCancelled {
+		t.Fatalf("wanted cancelled simulation, got %s", sim.Status.Status)
+	}
+}
@@ -0,0 +1,60 @@
+package simulation
+
+import (
+	"fmt"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+)
+
+// getStateHashCmd returns the command reporting the hash of the exported
+// state in the termination message of the simulation container.
+func getStateHashCmd() string {
+	return fmt.Sprintf("[ -f %[1]s ] && echo %[2]s=$(sha256sum %[1]s | cut -d ' ' -f 1) >> /dev/termination-log; ",
+		stateExportPath, stateHashResult)
+}
+
+// updateDeterminismStatus marks the replicas of the seeds which ended in
+// different states as Nondeterministic, once all of them succeeded.
+func updateDeterminismStatus(sim *toolsv1.Simulation) {
+	if sim.Spec.Config.Determinism == nil || sim.Spec.Config.Determinism.Replicas < 2 {
+		return
+	}
+
+	groups := make(map[string]string)
+	for _, c := range getMatrixCells(sim) {
+		groups[c.Name] = c.group
+	}
+
+	// Replicas are grouped by their seed and matrix values
+	replicas := make(map[string][]*toolsv1.JobStatus)
+	for i := range sim.Status.JobStatus {
+		status := &sim.Status.JobStatus[i]
+		key := groups[status.Cell] + "/" + status.Stage + "/" + status.Seed
+		replicas[key] = append(replicas[key], status)
+	}
+
+	for _, statuses := range replicas {
+		if len(statuses) < sim.Spec.Config.Determinism.Replicas {
+			continue
+		}
+
+		// The states are compared once every replica succeeded
+		compared, deterministic := true, true
+		for _, s := range statuses {
+			if s.Status != toolsv1.SimulationSucceed && s.Status != toolsv1.SimulationNondeterministic || s.StateHash == "" {
+				compared = false
+				break
+			}
+			deterministic = deterministic && s.StateHash == statuses[0].StateHash
+		}
+
+		if compared && !deterministic {
+			for _, s := range statuses {
+				s.Status = toolsv1.SimulationNondeterministic
+				s.Reason = nondeterministicReason
+				s.Message = "replicas of the seed ended in different states"
+				s.FailureType = toolsv1.AppFailure
+			}
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package simulation
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+)
+
+func TestUpdateDeterminismStatus(t *testing.T) {
+	sim := &toolsv1.Simulation{ObjectMeta: metav1.ObjectMeta{Name: "sim"}}
+	sim.Spec.Config.Determinism = &toolsv1.DeterminismSpec{Replicas: 2, Architectures: []string{"amd64", "arm64"}}
+	sim.Spec.Matrix = &toolsv1.MatrixSpec{BlockSizes: []int{100, 200}}
+
+	cells := getMatrixCells(sim)
+	if len(cells) != 4 || cells[0].Name != "bs100-1db39c" || cells[1].Name != "bs100-1db39c-r1" || cells[1].group != "bs100-1db39c" || cells[1].arch != "arm64" {
+		t.Fatalf("unexpected cells %+v", cells)
+	}
+
+	job, err := getJobSpec(sim, cells[1], "7", defaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Spec.Template.Spec.NodeSelector[corev1.LabelArchStable] != "arm64" {
+		t.Fatalf("wanted replica to run on arm64, got %v", job.Spec.Template.Spec.NodeSelector)
+	}
+	if cmd := job.Spec.Template.Spec.Containers[0].Args[2]; !strings.Contains(cmd, "-ExportStatePath") || !strings.Contains(cmd, stateHashResult) {
+		t.Fatalf("wanted state to be exported and hashed, got %s", cmd)
+	}
+
+	set := func(cell matrixCell, seed string, status toolsv1.SimStatus, hash string) {
+		setJobStatus(sim, cell, seed, status)
+		getJobStatus(sim, getJobName(sim, cell.Name, seed)).StateHash = hash
+	}
+	// Seed 1 diverges for block size 100 only, seed 2 is still running
+	set(cells[0], "1", toolsv1.SimulationSucceed, "a")
+	set(cells[1], "1", toolsv1.SimulationSucceed, "b")
+	set(cells[2], "1", toolsv1.SimulationSucceed, "a")
+	set(cells[3], "1", toolsv1.SimulationSucceed, "a")
+	set(cells[0], "2", toolsv1.SimulationSucceed, "a")
+	set(cells[1], "2", toolsv1.SimulationRunning, "")
+
+	updateDeterminismStatus(sim)
+
+	for _, s := range sim.Status.JobStatus {
+		nondeterministic := s.Seed == "1" && strings.HasPrefix(s.Cell, "bs100")
+		if nondeterministic != (s.Status == toolsv1.SimulationNondeterministic) {
+			t.Fatalf("unexpected status %s for %s", s.Status, s.Name)
+		}
+	}
+
+	updateGlobalStatus(sim)
+	if *sim.Status.Failed != 2 {
+		t.Fatalf("wanted nondeterministic seeds to count as failed, got %d", *sim.Status.Failed)
+	}
+
+	// Replicas of modes which do not export the state cannot be compared
+	if err := validateSimulation(sim, defaultOptions()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sim.Spec.Config.Mode = toolsv1.NondeterminismMode
+	if err := validateSimulation(sim, defaultOptions()); err == nil {
+		t.Fatalf("wanted replicas of the nondeterminism mode to be rejected")
+	}
+}
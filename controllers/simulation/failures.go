@@ -0,0 +1,155 @@
+package simulation
+
+import (
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+	"github.com/allinbits/runsim-operator/internal/tools"
+)
+
+// Reasons for which jobs fail or are stuck because of the infrastructure, as
+// reported by Kubernetes for their pods.
+const (
+	oomKilledReason           = "OOMKilled"
+	evictedReason             = "Evicted"
+	initContainerFailedReason = "InitContainerFailed"
+)
+
+// stateNotFoundReason is the reason of upgrades failing because the state
+// exported before the upgrade cannot be found.
+const stateNotFoundReason = "StateNotFound"
+
+// infrastructureWaitingReasons are the reasons for which containers which
+// cannot start wait.
+var infrastructureWaitingReasons = map[string]bool{
+	"ErrImagePull":               true,
+	"ImagePullBackOff":           true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+}
+
+// appInitContainers are the init containers which fail because of the app,
+// such as a version which does not exist or does not build, rather than
+// because of the infrastructure.
+var appInitContainers = map[string]bool{
+	cloneContainerName:        true,
+	goModContainerName:        true,
+	patchGenesisContainerName: true,
+}
+
+// infrastructureTerminationReasons are the reasons for which the controller
+// terminates jobs which are due to the infrastructure.
+var infrastructureTerminationReasons = map[string]bool{
+	deadlineExceededReason:      true,
+	setupDeadlineExceededReason: true,
+}
+
+// updateJobFailure records why the job failed, telling failures of the app
+// apart from infrastructure problems, or why it is stuck if it did not finish.
+func updateJobFailure(sim *toolsv1.Simulation, job *batchv1.Job, pod *corev1.Pod) {
+	status := getJobStatus(sim, job.Name)
+	if status == nil || status.FailureType != "" {
+		return
+	}
+
+	if !isJobFailed(status.Status) {
+		// Problems of unfinished jobs are reported until they are solved
+		if status.Status == toolsv1.SimulationRunning || status.Status == toolsv1.SimulationPending {
+			status.Reason, status.Message = getWaitingReason(pod)
+		}
+		return
+	}
+
+	failureType, reason, message := getFailure(job, pod)
+	status.FailureType = failureType
+	if failureType == toolsv1.InfrastructureFailure {
+		status.Reason, status.Message = reason, message
+		return
+	}
+
+	// The reason found in the output of the simulation is more specific
+	if status.Reason == "" {
+		status.Reason = reason
+	}
+	if status.Message == "" {
+		status.Message = message
+	}
+}
+
+// getFailure returns whether the job failed because of the infrastructure or
+// of the app, from the container which failed and how, along with the reason
+// and message of the failure when they are known.
+func getFailure(job *batchv1.Job, pod *corev1.Pod) (toolsv1.FailureType, string, string) {
+	if reason := job.Annotations[TerminatedAnnotation]; infrastructureTerminationReasons[reason] {
+		return toolsv1.InfrastructureFailure, reason, "the job was terminated by the controller"
+	}
+
+	if pod != nil {
+		if pod.Status.Reason == evictedReason {
+			return toolsv1.InfrastructureFailure, evictedReason, pod.Status.Message
+		}
+		if reason, message := getWaitingReason(pod); reason != "" {
+			return toolsv1.InfrastructureFailure, reason, message
+		}
+
+		for _, cs := range pod.Status.InitContainerStatuses {
+			t := cs.State.Terminated
+			switch {
+			case t == nil || t.ExitCode == 0:
+				continue
+			case t.Reason == oomKilledReason:
+				return toolsv1.InfrastructureFailure, oomKilledReason, fmt.Sprintf("container %s exceeded its memory limit", cs.Name)
+			case cs.Name == downloadStateContainerName && t.ExitCode == tools.StateNotFoundExitCode:
+				return toolsv1.AppFailure, stateNotFoundReason, "the state exported by the previous stage was not found"
+			case appInitContainers[cs.Name]:
+				return toolsv1.AppFailure, initContainerFailedReason, fmt.Sprintf("init container %s exited with code %d", cs.Name, t.ExitCode)
+			default:
+				return toolsv1.InfrastructureFailure, initContainerFailedReason, fmt.Sprintf("init container %s exited with code %d", cs.Name, t.ExitCode)
+			}
+		}
+		for _, cs := range pod.Status.ContainerStatuses {
+			if t := cs.State.Terminated; t != nil && t.Reason == oomKilledReason {
+				return toolsv1.InfrastructureFailure, oomKilledReason, fmt.Sprintf("container %s exceeded its memory limit", cs.Name)
+			}
+		}
+	}
+
+	// The job controller fails jobs exceeding their deadline, killing their pods
+	for _, c := range job.Status.Conditions {
+		if c.Type == batchv1.JobFailed && c.Status == corev1.ConditionTrue && c.Reason == deadlineExceededReason {
+			return toolsv1.InfrastructureFailure, c.Reason, c.Message
+		}
+	}
+	return toolsv1.AppFailure, "", getExitMessage(pod)
+}
+
+// getWaitingReason returns why a container of the pod cannot start, if any.
+func getWaitingReason(pod *corev1.Pod) (string, string) {
+	if pod == nil {
+		return "", ""
+	}
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, cs := range statuses {
+		if w := cs.State.Waiting; w != nil && infrastructureWaitingReasons[w.Reason] {
+			return w.Reason, fmt.Sprintf("container %s: %s", cs.Name, w.Message)
+		}
+	}
+	return "", ""
+}
+
+// getExitMessage returns how the simulation container of the pod exited.
+func getExitMessage(pod *corev1.Pod) string {
+	if pod == nil {
+		return ""
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		if t := cs.State.Terminated; cs.Name == simulationContainerName && t != nil {
+			return fmt.Sprintf("container %s exited with code %d", cs.Name, t.ExitCode)
+		}
+	}
+	return ""
+}
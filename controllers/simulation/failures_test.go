@@ -0,0 +1,162 @@
+package simulation
+
+import (
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+	"github.com/allinbits/runsim-operator/internal/tools"
+)
+
+func TestUpdateJobFailure(t *testing.T) {
+	terminated := func(name, reason string, exitCode int32) corev1.ContainerStatus {
+		return corev1.ContainerStatus{Name: name, State: corev1.ContainerState{
+			Terminated: &corev1.ContainerStateTerminated{Reason: reason, ExitCode: exitCode},
+		}}
+	}
+	waiting := func(name, reason string) corev1.ContainerStatus {
+		return corev1.ContainerStatus{Name: name, State: corev1.ContainerState{
+			Waiting: &corev1.ContainerStateWaiting{Reason: reason, Message: "back-off pulling image"},
+		}}
+	}
+
+	tests := []struct {
+		name        string
+		status      toolsv1.SimStatus
+		reason      string
+		annotations map[string]string
+		conditions  []batchv1.JobCondition
+		pod         corev1.PodStatus
+		wantReason  string
+		wantType    toolsv1.FailureType
+	}{
+		{
+			name:       "oom killed",
+			status:     toolsv1.SimulationFailed,
+			pod:        corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{terminated(simulationContainerName, oomKilledReason, 137)}},
+			wantReason: oomKilledReason,
+			wantType:   toolsv1.InfrastructureFailure,
+		},
+		{
+			name:       "evicted",
+			status:     toolsv1.SimulationFailed,
+			pod:        corev1.PodStatus{Reason: evictedReason, Message: "The node was low on resource: memory."},
+			wantReason: evictedReason,
+			wantType:   toolsv1.InfrastructureFailure,
+		},
+		{
+			name:       "clone failed",
+			status:     toolsv1.SimulationFailed,
+			pod:        corev1.PodStatus{InitContainerStatuses: []corev1.ContainerStatus{terminated(cloneContainerName, "Error", 128)}},
+			wantReason: initContainerFailedReason,
+			wantType:   toolsv1.AppFailure,
+		},
+		{
+			name:       "exported state not found",
+			status:     toolsv1.SimulationFailed,
+			pod:        corev1.PodStatus{InitContainerStatuses: []corev1.ContainerStatus{terminated(downloadStateContainerName, "Error", tools.StateNotFoundExitCode)}},
+			wantReason: stateNotFoundReason,
+			wantType:   toolsv1.AppFailure,
+		},
+		{
+			name:       "exported state download failed",
+			status:     toolsv1.SimulationFailed,
+			pod:        corev1.PodStatus{InitContainerStatuses: []corev1.ContainerStatus{terminated(downloadStateContainerName, "Error", 1)}},
+			wantReason: initContainerFailedReason,
+			wantType:   toolsv1.InfrastructureFailure,
+		},
+		{
+			name:       "tools installation failed",
+			status:     toolsv1.SimulationFailed,
+			pod:        corev1.PodStatus{InitContainerStatuses: []corev1.ContainerStatus{terminated("install-tools", "Error", 1)}},
+			wantReason: initContainerFailedReason,
+			wantType:   toolsv1.InfrastructureFailure,
+		},
+		{
+			name:   "init container oom killed",
+			status: toolsv1.SimulationFailed,
+			pod: corev1.PodStatus{InitContainerStatuses: []corev1.ContainerStatus{
+				terminated(cloneContainerName, "Completed", 0),
+				terminated(goModContainerName, oomKilledReason, 137),
+			}},
+			wantReason: oomKilledReason,
+			wantType:   toolsv1.InfrastructureFailure,
+		},
+		{
+			name:        "setup deadline exceeded",
+			status:      toolsv1.SimulationFailed,
+			annotations: map[string]string{TerminatedAnnotation: setupDeadlineExceededReason},
+			pod:         corev1.PodStatus{InitContainerStatuses: []corev1.ContainerStatus{waiting("go-mod", "ImagePullBackOff")}},
+			wantReason:  setupDeadlineExceededReason,
+			wantType:    toolsv1.InfrastructureFailure,
+		},
+		{
+			name:   "job deadline exceeded",
+			status: toolsv1.SimulationFailed,
+			conditions: []batchv1.JobCondition{
+				{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: deadlineExceededReason, Message: "Job was active longer than specified deadline"},
+			},
+			wantReason: deadlineExceededReason,
+			wantType:   toolsv1.InfrastructureFailure,
+		},
+		{
+			name:       "app failure",
+			status:     toolsv1.SimulationFailed,
+			reason:     invariantBrokenReason,
+			pod:        corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{terminated(simulationContainerName, "Error", 1)}},
+			wantReason: invariantBrokenReason,
+			wantType:   toolsv1.AppFailure,
+		},
+		{
+			name:       "stuck pulling image",
+			status:     toolsv1.SimulationRunning,
+			pod:        corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{waiting(simulationContainerName, "ImagePullBackOff")}},
+			wantReason: "ImagePullBackOff",
+		},
+	}
+
+	for _, tt := range tests {
+		sim := &toolsv1.Simulation{ObjectMeta: metav1.ObjectMeta{Name: "sim"}}
+		setJobStatus(sim, matrixCell{}, "1", tt.status)
+		status := getJobStatus(sim, getJobName(sim, "", "1"))
+		status.Reason = tt.reason
+
+		job := &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: status.Name, Annotations: tt.annotations},
+			Status:     batchv1.JobStatus{Conditions: tt.conditions},
+		}
+		var pod *corev1.Pod
+		if tt.conditions == nil {
+			pod = &corev1.Pod{Status: tt.pod}
+		}
+
+		updateJobFailure(sim, job, pod)
+		if status.Reason != tt.wantReason || status.FailureType != tt.wantType {
+			t.Errorf("%s: wanted %s %s, got %s %s", tt.name, tt.wantReason, tt.wantType, status.Reason, status.FailureType)
+		}
+		if tt.wantReason != "" && status.Message == "" {
+			t.Errorf("%s: wanted a message", tt.name)
+		}
+	}
+}
+
+func TestUpdateGlobalFailureType(t *testing.T) {
+	sim := &toolsv1.Simulation{}
+	sim.Status.JobStatus = []toolsv1.JobStatus{
+		{Status: toolsv1.SimulationSucceed},
+		{Status: toolsv1.SimulationFailed, FailureType: toolsv1.InfrastructureFailure},
+	}
+	updateGlobalStatus(sim)
+	if sim.Status.FailureType != toolsv1.InfrastructureFailure || *sim.Status.InfrastructureFailures != 1 {
+		t.Fatalf("wanted infrastructure failure, got %s", sim.Status.FailureType)
+	}
+
+	sim.Status.JobStatus = append(sim.Status.JobStatus, toolsv1.JobStatus{Status: toolsv1.SimulationFailed, FailureType: toolsv1.AppFailure})
+	updateGlobalStatus(sim)
+	if sim.Status.FailureType != toolsv1.AppFailure || *sim.Status.AppFailures != 1 {
+		t.Fatalf("wanted app failure, got %s", sim.Status.FailureType)
+	}
+}
@@ -0,0 +1,239 @@
+package simulation
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+	"github.com/allinbits/runsim-operator/internal/genesis"
+)
+
+const (
+	genesisWorkers    = 2
+	genesisMaxRetries = 10
+	// genesisCacheTTL is the time after which cached information is
+	// revalidated against the remote before being used for a new simulation.
+	genesisCacheTTL = 10 * time.Minute
+	// genesisCacheExpiry is the time after which cached information which
+	// was not used is evicted, so that the cache does not grow forever.
+	genesisCacheExpiry = time.Hour
+)
+
+// genesisResolver retrieves information about remote genesis files in the
+// background, so that reconciles never block on the network. Results are cached
+// by URL and patches, revalidated using the ETag/Last-Modified headers, and
+// evicted once unused for genesisCacheExpiry.
+type genesisResolver struct {
+	log    logr.Logger
+	queue  workqueue.RateLimitingInterface
+	events chan event.GenericEvent
+
+	mu       sync.Mutex
+	requests map[string]*genesisRequest
+	cache    map[string]*genesisCacheEntry
+}
+
+type genesisRequest struct {
+	url     string
+	patches []toolsv1.GenesisPatch
+	waiters map[types.NamespacedName]struct{}
+}
+
+type genesisCacheEntry struct {
+	info      *genesis.Info
+	err       error
+	checkedAt time.Time
+	usedAt    time.Time
+}
+
+func newGenesisResolver(log logr.Logger) *genesisResolver {
+	return &genesisResolver{
+		log: log,
+		queue: workqueue.NewNamedRateLimitingQueue(
+			workqueue.NewItemExponentialFailureRateLimiter(5*time.Second, 10*time.Minute),
+			"genesis",
+		),
+		events:   make(chan event.GenericEvent, 1024),
+		requests: make(map[string]*genesisRequest),
+		cache:    make(map[string]*genesisCacheEntry),
+	}
+}
+
+// Lookup returns the information of the genesis provided in the simulation spec.
+// When it is not available yet a nil info is returned along with the error of the
+// last attempt, if any, and the simulation is enqueued for reconcile once resolved.
+func (g *genesisResolver) Lookup(sim *toolsv1.Simulation) (*genesis.Info, error) {
+	url, patches := sim.Spec.Config.Genesis.FromURL, sim.Spec.Config.Genesis.Patches
+	key := genesisCacheKey(url, patches)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	entry := g.cache[key]
+	if entry != nil {
+		entry.usedAt = time.Now()
+	}
+	if entry != nil && entry.info != nil && time.Since(entry.checkedAt) < genesisCacheTTL {
+		return entry.info, nil
+	}
+
+	req, ok := g.requests[key]
+	if !ok {
+		req = &genesisRequest{
+			url:     url,
+			patches: patches,
+			waiters: make(map[types.NamespacedName]struct{}),
+		}
+		g.requests[key] = req
+		g.queue.Add(key)
+	}
+	req.waiters[types.NamespacedName{Namespace: sim.Namespace, Name: sim.Name}] = struct{}{}
+
+	if entry != nil {
+		return nil, entry.err
+	}
+	return nil, nil
+}
+
+// LookupConfigMap returns the information of the genesis stored under key in
+// the ConfigMap. ConfigMaps are small enough to be read during reconciles, and
+// the information is cached by version of the ConfigMap.
+func (g *genesisResolver) LookupConfigMap(cm *corev1.ConfigMap, key string, patches []toolsv1.GenesisPatch) (*genesis.Info, error) {
+	var r io.Reader
+	if data, ok := cm.Data[key]; ok {
+		r = strings.NewReader(data)
+	} else if data, ok := cm.BinaryData[key]; ok {
+		r = bytes.NewReader(data)
+	} else {
+		return nil, fmt.Errorf("key %s not found in configmap %s", key, cm.Name)
+	}
+
+	cacheKey := genesisCacheKey(fmt.Sprintf("configmap://%s/%s/%s@%s", cm.Namespace, cm.Name, key, cm.ResourceVersion), patches)
+	g.mu.Lock()
+	entry := g.cache[cacheKey]
+	if entry != nil {
+		entry.usedAt = time.Now()
+	}
+	g.mu.Unlock()
+	if entry != nil && entry.info != nil {
+		return entry.info, nil
+	}
+
+	info, err := genesis.GetInfo(r, patches)
+	if err != nil {
+		return nil, err
+	}
+	g.mu.Lock()
+	g.cache[cacheKey] = &genesisCacheEntry{info: info, checkedAt: time.Now(), usedAt: time.Now()}
+	g.mu.Unlock()
+	return info, nil
+}
+
+// Start runs the workers until stop is closed.
+// Genesis being downloaded are aborted once stop is closed.
+func (g *genesisResolver) Start(stop <-chan struct{}) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for i := 0; i < genesisWorkers; i++ {
+		go wait.Until(func() {
+			for g.processNextItem(ctx) {
+			}
+		}, time.Second, stop)
+	}
+	go wait.Until(func() { g.evict(time.Now()) }, genesisCacheTTL, stop)
+
+	<-stop
+	cancel()
+	g.queue.ShutDown()
+	return nil
+}
+
+func (g *genesisResolver) processNextItem(ctx context.Context) bool {
+	item, quit := g.queue.Get()
+	if quit {
+		return false
+	}
+	defer g.queue.Done(item)
+	key := item.(string)
+
+	g.mu.Lock()
+	req := g.requests[key]
+	var cached *genesis.Info
+	if entry := g.cache[key]; entry != nil {
+		cached = entry.info
+	}
+	g.mu.Unlock()
+
+	if req == nil {
+		g.queue.Forget(key)
+		return true
+	}
+
+	log := g.log.WithValues("url", req.url)
+	log.Info("resolving genesis")
+	info, err := genesis.GetInfoFromRemote(ctx, req.url, req.patches, cached)
+
+	g.mu.Lock()
+	if err != nil {
+		log.Error(err, "could not retrieve information from genesis")
+		g.cache[key] = &genesisCacheEntry{info: cached, err: err, checkedAt: time.Time{}, usedAt: time.Now()}
+		if g.queue.NumRequeues(key) < genesisMaxRetries {
+			g.queue.AddRateLimited(key)
+		} else {
+			g.queue.Forget(key)
+			delete(g.requests, key)
+		}
+	} else {
+		g.cache[key] = &genesisCacheEntry{info: info, checkedAt: time.Now(), usedAt: time.Now()}
+		g.queue.Forget(key)
+		delete(g.requests, key)
+	}
+	waiters := make([]types.NamespacedName, 0, len(req.waiters))
+	for w := range req.waiters {
+		waiters = append(waiters, w)
+	}
+	g.mu.Unlock()
+
+	// Reconcile waiting simulations, either to report the genesis or the error
+	for _, w := range waiters {
+		sim := &toolsv1.Simulation{ObjectMeta: metav1.ObjectMeta{Namespace: w.Namespace, Name: w.Name}}
+		g.events <- event.GenericEvent{Meta: sim, Object: sim}
+	}
+	return true
+}
+
+// evict removes the cached information which was not used recently, unless
+// it is being resolved.
+func (g *genesisResolver) evict(now time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for key, entry := range g.cache {
+		if _, ok := g.requests[key]; !ok && now.Sub(entry.usedAt) > genesisCacheExpiry {
+			delete(g.cache, key)
+		}
+	}
+}
+
+func genesisCacheKey(url string, patches []toolsv1.GenesisPatch) string {
+	if len(patches) == 0 {
+		return url
+	}
+	b, _ := json.Marshal(patches)
+	return fmt.Sprintf("%s#%x", url, sha256.Sum256(b))
+}
@@ -0,0 +1,66 @@
+package simulation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+)
+
+func TestUpdateGenesisStatusFromConfigMap(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = toolsv1.AddToScheme(scheme)
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "genesis", Namespace: "default"},
+		Data:       map[string]string{DefaultGenesisConfigMapKey: `{"chain_id":"cosmoshub-4","app_state":{}}`},
+	}
+	r := &SimulationReconciler{
+		Client:  fake.NewFakeClientWithScheme(scheme, cm),
+		log:     zap.New(),
+		genesis: newGenesisResolver(zap.New()),
+	}
+
+	sim := &toolsv1.Simulation{ObjectMeta: metav1.ObjectMeta{Name: "sim", Namespace: "default"}}
+	sim.Spec.Config.Genesis = &toolsv1.GenesisSpec{
+		FromConfigMap: &toolsv1.FromConfigMapConfig{Name: "missing", Key: DefaultGenesisConfigMapKey},
+		Patches:       []toolsv1.GenesisPatch{{Type: toolsv1.SetChainId, Value: "simulation-1"}},
+	}
+	if err := r.updateGenesisStatus(context.Background(), sim); err != nil {
+		t.Fatal(err)
+	}
+	if c := getCondition(sim, toolsv1.GenesisResolved); c == nil || c.Status != corev1.ConditionFalse || sim.Status.Genesis != nil {
+		t.Fatalf("wanted missing configmap to be reported, got %+v", c)
+	}
+
+	sim.Spec.Config.Genesis.FromConfigMap.Name = "genesis"
+	if err := r.updateGenesisStatus(context.Background(), sim); err != nil {
+		t.Fatal(err)
+	}
+	g := sim.Status.Genesis
+	if g == nil || g.ChainId != "simulation-1" || g.Sha256 == "" || g.PatchedSha256 == "" || g.Sha256 == g.PatchedSha256 {
+		t.Fatalf("wanted genesis of the configmap to be reported after patching, got %+v", g)
+	}
+	if c := getCondition(sim, toolsv1.GenesisResolved); c == nil || c.Status != corev1.ConditionTrue {
+		t.Fatalf("wanted genesis to be resolved, got %+v", c)
+	}
+
+	// Unused information is evicted
+	r.genesis.evict(time.Now())
+	if len(r.genesis.cache) != 1 {
+		t.Fatalf("wanted recently used information to be kept")
+	}
+	r.genesis.evict(time.Now().Add(2 * genesisCacheExpiry))
+	if len(r.genesis.cache) != 0 {
+		t.Fatalf("wanted unused information to be evicted")
+	}
+}
@@ -2,22 +2,33 @@ package simulation
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"strings"
 
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/utils/pointer"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+	"github.com/allinbits/runsim-operator/internal/tools"
 )
 
-func (r *SimulationReconciler) CreateJob(ctx context.Context, sim *toolsv1.Simulation, seed string) (*batchv1.Job, error) {
-	job := getJobSpec(sim, seed)
+func (r *SimulationReconciler) CreateJob(ctx context.Context, sim *toolsv1.Simulation, cell matrixCell, seed string) (*batchv1.Job, error) {
+	job, err := getJobSpec(sim, cell, seed, r.opts)
+	if err != nil {
+		return nil, err
+	}
 
 	if r.opts.ImagePullSecret != "" {
 		job.Spec.Template.Spec.ImagePullSecrets = []corev1.LocalObjectReference{{
@@ -36,26 +47,96 @@ func (r *SimulationReconciler) CreateJob(ctx context.Context, sim *toolsv1.Simul
 	return job, nil
 }
 
-func (r *SimulationReconciler) MaybeDeleteJob(ctx context.Context, sim *toolsv1.Simulation, seed string) error {
-	err := r.Delete(ctx, getJobSpec(sim, seed))
+func (r *SimulationReconciler) MaybeDeleteJob(ctx context.Context, sim *toolsv1.Simulation, cell, seed string) error {
+	job, err := r.GetJob(ctx, sim, cell, seed)
+	if err != nil || job == nil {
+		return err
+	}
+
+	// Jobs orphan their pods by default
+	err = r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground))
 	if err != nil && errors.IsNotFound(err) {
 		return nil
 	}
 	return err
 }
 
-func (r *SimulationReconciler) GetJob(ctx context.Context, sim *toolsv1.Simulation, seed string) (*batchv1.Job, error) {
+// GetJob returns the job running the seed within the matrix cell, or nil if
+// there is none. Jobs are looked up by their labels.
+func (r *SimulationReconciler) GetJob(ctx context.Context, sim *toolsv1.Simulation, cell, seed string) (*batchv1.Job, error) {
+	selector, err := getJobSelector(sim, cell, seed)
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs batchv1.JobList
+	if err := r.List(ctx, &jobs,
+		client.InNamespace(sim.Namespace),
+		client.MatchingLabelsSelector{Selector: selector},
+	); err != nil {
+		return nil, err
+	}
+	if len(jobs.Items) > 0 {
+		return &jobs.Items[0], nil
+	}
+	return r.migrateJob(ctx, sim, cell, seed)
+}
+
+// migrateJob labels the job created for the seed before jobs were looked up
+// by label, if any. Such jobs are named as their seed, which fit in job names.
+// Jobs of other owners with the same name are left alone.
+func (r *SimulationReconciler) migrateJob(ctx context.Context, sim *toolsv1.Simulation, cell, seed string) (*batchv1.Job, error) {
 	job := &batchv1.Job{}
-	err := r.Get(ctx, types.NamespacedName{Namespace: sim.Namespace, Name: getJobName(sim, seed)}, job)
+	err := r.Get(ctx, types.NamespacedName{Namespace: sim.Namespace, Name: getJobName(sim, cell, seed)}, job)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			return nil, nil
 		}
 		return nil, err
 	}
+	if !metav1.IsControlledBy(job, sim) {
+		return nil, nil
+	}
+
+	if job.Labels == nil {
+		job.Labels = make(map[string]string)
+	}
+	for k, v := range getJobLabels(sim, cell, seed) {
+		job.Labels[k] = v
+	}
+	if job.Annotations == nil {
+		job.Annotations = make(map[string]string)
+	}
+	job.Annotations[SeedAnnotation] = seed
+
+	r.log.WithValues("simulation", sim.Name).Info("labelling job", "job", job.Name, "seed", seed)
+	if err := r.Update(ctx, job); err != nil {
+		return nil, err
+	}
 	return job, nil
 }
 
+// getJobPod returns the pod created by the job, or nil if there is none.
+func (r *SimulationReconciler) getJobPod(ctx context.Context, job *batchv1.Job) (*corev1.Pod, error) {
+	if job.Spec.Selector == nil {
+		return nil, nil
+	}
+
+	var jobPods corev1.PodList
+	if err := r.Client.List(ctx,
+		&jobPods,
+		client.InNamespace(job.Namespace),
+		client.MatchingLabels(job.Spec.Selector.MatchLabels),
+	); err != nil {
+		return nil, err
+	}
+
+	if len(jobPods.Items) == 0 {
+		return nil, nil
+	}
+	return &jobPods.Items[0], nil
+}
+
 func (r *SimulationReconciler) getJobPods(job *batchv1.Job) ([]*corev1.Pod, error) {
 	labelSelector := metav1.LabelSelector{MatchLabels: map[string]string{"controller-uid": string(job.ObjectMeta.UID)}}
 	podList, err := r.clientset.CoreV1().Pods(job.Namespace).List(metav1.ListOptions{
@@ -88,11 +169,57 @@ func (r *SimulationReconciler) removeSafeToEvictAnnotation(job *batchv1.Job) err
 	return nil
 }
 
-func getJobName(sim *toolsv1.Simulation, seed string) string {
-	return fmt.Sprintf("%s-%s", sim.Name, seed)
+// getJobName returns the name of the job running the seed within the matrix
+// cell. Names that do not fit in the job-name label of the job pods are
+// truncated and suffixed with a hash of the full name.
+func getJobName(sim *toolsv1.Simulation, cell, seed string) string {
+	name := fmt.Sprintf("%s-%s", sim.Name, seed)
+	if cell != "" {
+		name = fmt.Sprintf("%s-%s-%s", sim.Name, cell, seed)
+	}
+	return shortenName(name)
+}
+
+// shortenName returns the name, truncated and suffixed with its hash if it
+// is longer than allowed for label values.
+func shortenName(name string) string {
+	if len(name) <= validation.LabelValueMaxLength {
+		return name
+	}
+	sum := sha256.Sum256([]byte(name))
+	hash := hex.EncodeToString(sum[:])[:nameHashLength]
+	prefix := strings.TrimRight(name[:validation.LabelValueMaxLength-nameHashLength-1], "-_.")
+	return prefix + "-" + hash
+}
+
+// getJobLabels returns the labels identifying the job running the seed within
+// the matrix cell.
+func getJobLabels(sim *toolsv1.Simulation, cell, seed string) map[string]string {
+	jobLabels := map[string]string{
+		NameLabelKey: shortenName(sim.Name),
+		SeedLabelKey: shortenName(seed),
+	}
+	if cell != "" {
+		jobLabels[MatrixCellLabelKey] = shortenName(cell)
+	}
+	return jobLabels
+}
+
+// getJobSelector returns the selector matching the job running the seed
+// within the matrix cell.
+func getJobSelector(sim *toolsv1.Simulation, cell, seed string) (labels.Selector, error) {
+	selector := labels.SelectorFromSet(getJobLabels(sim, cell, seed))
+	if cell == "" {
+		req, err := labels.NewRequirement(MatrixCellLabelKey, selection.DoesNotExist, nil)
+		if err != nil {
+			return nil, err
+		}
+		selector = selector.Add(*req)
+	}
+	return selector, nil
 }
 
-func updateJobStatus(sim *toolsv1.Simulation, job *batchv1.Job) error {
+func updateJobStatus(sim *toolsv1.Simulation, cell matrixCell, job *batchv1.Job) error {
 	if sim.Status.JobStatus == nil {
 		sim.Status.JobStatus = make([]toolsv1.JobStatus, 0)
 	}
@@ -102,6 +229,8 @@ func updateJobStatus(sim *toolsv1.Simulation, job *batchv1.Job) error {
 	switch {
 	case job.Status.Succeeded > 0:
 		status = toolsv1.SimulationSucceed
+	case job.Status.Failed > 0 && job.Annotations[TerminatedAnnotation] == cancelledReason:
+		status = toolsv1.SimulationCancelled
 	case job.Status.Failed > 0:
 		status = toolsv1.SimulationFailed
 	case job.Status.Active > 0:
@@ -120,15 +249,71 @@ func updateJobStatus(sim *toolsv1.Simulation, job *batchv1.Job) error {
 
 	if !jobsExists {
 		sim.Status.JobStatus = append(sim.Status.JobStatus, toolsv1.JobStatus{
-			Name:   job.Name,
-			Seed:   job.Annotations[SeedAnnotation],
-			Status: status,
+			Name:       job.Name,
+			Seed:       job.Annotations[SeedAnnotation],
+			Stage:      cell.stage,
+			Cell:       cell.Name,
+			Parameters: cell.Parameters,
+			Status:     status,
 		})
 	}
 
 	return nil
 }
 
+// updateJobCommit records the commit checked out by the job pod, which is
+// reported by the clone-repo container.
+func updateJobCommit(sim *toolsv1.Simulation, job *batchv1.Job, pod *corev1.Pod) {
+	status := getJobStatus(sim, job.Name)
+	if status == nil || status.Commit != "" || pod == nil {
+		return
+	}
+
+	for _, cs := range pod.Status.InitContainerStatuses {
+		if cs.Name == cloneContainerName && cs.State.Terminated != nil && cs.State.Terminated.ExitCode == 0 {
+			status.Commit = strings.TrimSpace(cs.State.Terminated.Message)
+		}
+	}
+}
+
+// setJobStatus sets the status of the seed, which may not have a job.
+func setJobStatus(sim *toolsv1.Simulation, cell matrixCell, seed string, s toolsv1.SimStatus) {
+	name := getJobName(sim, cell.Name, seed)
+	if status := getJobStatus(sim, name); status != nil {
+		status.Status = s
+		return
+	}
+	sim.Status.JobStatus = append(sim.Status.JobStatus, toolsv1.JobStatus{
+		Name:       name,
+		Seed:       seed,
+		Stage:      cell.stage,
+		Cell:       cell.Name,
+		Parameters: cell.Parameters,
+		Status:     s,
+	})
+}
+
+// isJobFinished returns whether the simulation of a seed ran to completion,
+// or will not run as a previous stage did not succeed.
+func isJobFinished(s toolsv1.SimStatus) bool {
+	return s == toolsv1.SimulationSucceed || s == toolsv1.SimulationSkipped || isJobFailed(s)
+}
+
+// isJobFailed returns whether the simulation of a seed ran to completion
+// without succeeding.
+func isJobFailed(s toolsv1.SimStatus) bool {
+	return s == toolsv1.SimulationFailed || s == toolsv1.SimulationNondeterministic
+}
+
+func getJobStatus(sim *toolsv1.Simulation, jobName string) *toolsv1.JobStatus {
+	for i, j := range sim.Status.JobStatus {
+		if j.Name == jobName {
+			return &sim.Status.JobStatus[i]
+		}
+	}
+	return nil
+}
+
 func removeJobFromStatus(sim *toolsv1.Simulation, jobName string) {
 	for i, j := range sim.Status.JobStatus {
 		if j.Name == jobName {
@@ -138,18 +323,35 @@ func removeJobFromStatus(sim *toolsv1.Simulation, jobName string) {
 	}
 }
 
-func getJobSpec(sim *toolsv1.Simulation, seed string) *batchv1.Job {
-	simCommand := "trap \"[ -p /workspace/.tmp/params ] && echo '' > /workspace/.tmp/params; " +
-		"[ -p /workspace/.tmp/state ] && echo '' > /workspace/.tmp/state\" EXIT; cd /workspace; " +
-		getSimulationCmd(sim, seed)
+func getJobSpec(sim *toolsv1.Simulation, cell matrixCell, seed string, opts *Options) (*batchv1.Job, error) {
+	// The job runs the simulation spec with the values of its matrix cell
+	sim = cell.apply(sim)
+
+	// The output lines the result is interpreted from are kept, and the
+	// state is exported to be compared with other replicas. The resources
+	// used are reported along with the result
+	mode := getSimulationMode(sim)
+	determinism := sim.Spec.Config.Determinism != nil && sim.Spec.Config.Determinism.Replicas > 1
+	simCommand := fmt.Sprintf("mkdir -p %s; cd /workspace; %s 2>&1 | %s; rc=${PIPESTATUS[0]}; %s",
+		tmpDir, getSimulationCmd(sim, cell, seed, mode.exports && determinism), getOutputCmd(mode), getResultCmd(mode))
+	if opts.podArtifactsEnabled() {
+		simCommand = fmt.Sprintf("mkdir -p %s; start=$(%s); cd /workspace; %s 2>&1 | %s; rc=${PIPESTATUS[0]}; %s%s%s",
+			tmpDir, dateCmd, getSimulationCmd(sim, cell, seed, mode.exports), getOutputCmd(mode), getResultCmd(mode),
+			getSimulationEndCmd(), getArtifactsCmd(sim, cell.Name, seed))
+	}
+	if determinism {
+		simCommand += getStateHashCmd()
+	}
+	if mode.benchmark {
+		simCommand += getBenchmarkCmd()
+	}
+	simCommand += getResourceUsageCmd() + "exit $rc"
 
 	job := &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      getJobName(sim, seed),
+			Name:      getJobName(sim, cell.Name, seed),
 			Namespace: sim.Namespace,
-			Labels: map[string]string{
-				NameLabelKey: sim.Name,
-			},
+			Labels:    getJobLabels(sim, cell.Name, seed),
 			Annotations: map[string]string{
 				SeedAnnotation: seed,
 			},
@@ -158,7 +360,11 @@ func getJobSpec(sim *toolsv1.Simulation, seed string) *batchv1.Job {
 			BackoffLimit: pointer.Int32Ptr(0),
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						NameLabelKey: shortenName(sim.Name),
+					},
 					Annotations: map[string]string{
+						NameAnnotation:          sim.Name,
 						CASafeToEvictAnnotation: "false",
 					},
 				},
@@ -182,14 +388,9 @@ func getJobSpec(sim *toolsv1.Simulation, seed string) *batchv1.Job {
 					InitContainers: []corev1.Container{
 						// Init container for cloning repository
 						{
-							Name:  "clone-repo",
-							Image: "alpine/git",
-							Args: []string{
-								"clone", "--single-branch",
-								"--depth", "1",
-								"--branch", sim.Spec.Target.Version,
-								sim.Spec.Target.Repo, "/workspace",
-							},
+							Name:    cloneContainerName,
+							Image:   "alpine/git",
+							Command: []string{"sh", "-c", getCloneCmd(sim)},
 							VolumeMounts: []corev1.VolumeMount{
 								{
 									Name:      "data",
@@ -199,7 +400,7 @@ func getJobSpec(sim *toolsv1.Simulation, seed string) *batchv1.Job {
 						},
 						// Download go dependencies
 						{
-							Name:  "go-mod",
+							Name:  goModContainerName,
 							Image: "golang",
 							Args:  []string{"bash", "-c", "cd /workspace && go mod download"},
 							VolumeMounts: []corev1.VolumeMount{
@@ -213,22 +414,6 @@ func getJobSpec(sim *toolsv1.Simulation, seed string) *batchv1.Job {
 								},
 							},
 						},
-						// Initialize required fifos
-						{
-							Name:  "init-fifos",
-							Image: "busybox",
-							Args: []string{
-								"sh", "-c",
-								"mkdir -p /workspace/.tmp && mkfifo /workspace/.tmp/state && mkfifo /workspace/.tmp/params",
-							},
-							VolumeMounts: []corev1.VolumeMount{
-								{
-									Name:      "data",
-									MountPath: "/workspace",
-								},
-							},
-							ImagePullPolicy: corev1.PullIfNotPresent,
-						},
 					},
 					Containers: []corev1.Container{
 						// Main container performing the simulation
@@ -248,30 +433,6 @@ func getJobSpec(sim *toolsv1.Simulation, seed string) *batchv1.Job {
 							},
 							Resources: sim.Spec.Config.Resources,
 						},
-						{
-							Name:  stateContainerName,
-							Image: "busybox",
-							Args:  []string{"sh", "-c", "cat /workspace/.tmp/state && rm /workspace/.tmp/state"},
-							VolumeMounts: []corev1.VolumeMount{
-								{
-									Name:      "data",
-									MountPath: "/workspace",
-								},
-							},
-							ImagePullPolicy: corev1.PullIfNotPresent,
-						},
-						{
-							Name:  paramsContainerName,
-							Image: "busybox",
-							Args:  []string{"sh", "-c", "cat /workspace/.tmp/params && rm /workspace/.tmp/params"},
-							VolumeMounts: []corev1.VolumeMount{
-								{
-									Name:      "data",
-									MountPath: "/workspace",
-								},
-							},
-							ImagePullPolicy: corev1.PullIfNotPresent,
-						},
 					},
 					RestartPolicy: corev1.RestartPolicyNever,
 				},
@@ -285,7 +446,7 @@ func getJobSpec(sim *toolsv1.Simulation, seed string) *batchv1.Job {
 			Image: "busybox",
 			Args: []string{
 				"sh", "-c",
-				fmt.Sprintf("wget %s --no-check-certificate -O /workspace/.tmp/genesis.json", sim.Spec.Config.Genesis.FromURL),
+				fmt.Sprintf("mkdir -p %s && wget %s --no-check-certificate -O %s", tmpDir, sim.Spec.Config.Genesis.FromURL, downloadedGenesisPath),
 			},
 			VolumeMounts: []corev1.VolumeMount{
 				{
@@ -312,25 +473,218 @@ func getJobSpec(sim *toolsv1.Simulation, seed string) *batchv1.Job {
 		})
 	}
 
-	return job
+	// Install tools used by the simulation container to upload artifacts
+	if opts.podArtifactsEnabled() {
+		job.Spec.Template.Spec.Volumes = append(job.Spec.Template.Spec.Volumes, corev1.Volume{
+			Name: "tools",
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		})
+		job.Spec.Template.Spec.InitContainers = append(job.Spec.Template.Spec.InitContainers, corev1.Container{
+			Name:    "install-tools",
+			Image:   opts.ToolsImage,
+			Command: []string{"/manager", tools.InstallCommand, toolsBinPath},
+			VolumeMounts: []corev1.VolumeMount{
+				{
+					Name:      "tools",
+					MountPath: toolsMountPath,
+				},
+			},
+		})
+		job.Spec.Template.Spec.Containers[0].VolumeMounts = append(job.Spec.Template.Spec.Containers[0].VolumeMounts, corev1.VolumeMount{
+			Name:      "tools",
+			ReadOnly:  true,
+			MountPath: toolsMountPath,
+		})
+		if opts.ArtifactStore == FilesystemArtifactStore {
+			job.Spec.Template.Spec.Volumes = append(job.Spec.Template.Spec.Volumes, corev1.Volume{
+				Name: "artifacts",
+				VolumeSource: corev1.VolumeSource{
+					PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+						ClaimName: opts.ArtifactsPVC,
+					},
+				},
+			})
+			job.Spec.Template.Spec.Containers[0].VolumeMounts = append(job.Spec.Template.Spec.Containers[0].VolumeMounts, corev1.VolumeMount{
+				Name:      "artifacts",
+				MountPath: artifactsMountPath,
+			})
+		}
+		job.Spec.Template.Spec.Containers[0].EnvFrom = []corev1.EnvFromSource{
+			{
+				SecretRef: &corev1.SecretEnvSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: getArtifactsSecretName(sim)},
+				},
+			},
+		}
+		if ref := sim.Spec.Artifacts.SecretRef; ref != nil && opts.ArtifactStore == S3ArtifactStore {
+			job.Spec.Template.Spec.Containers[0].EnvFrom = append(job.Spec.Template.Spec.Containers[0].EnvFrom, corev1.EnvFromSource{
+				SecretRef: &corev1.SecretEnvSource{LocalObjectReference: *ref},
+			})
+		}
+	}
+
+	if cell.previous != "" && opts.podArtifactsEnabled() {
+		addDownloadStateContainer(job, sim, cell, seed)
+	}
+
+	if len(sim.Spec.Pipeline) > 0 {
+		applyPipeline(job, sim, cell, seed, opts)
+	}
+
+	if sim.Spec.Artifacts.ServiceAccountName != "" {
+		job.Spec.Template.Spec.ServiceAccountName = sim.Spec.Artifacts.ServiceAccountName
+	}
+
+	if cell.arch != "" {
+		job.Spec.Template.Spec.NodeSelector = map[string]string{corev1.LabelArchStable: cell.arch}
+	}
+
+	if sim.Spec.Config.ActiveDeadline != "" {
+		deadline, err := parseDeadline(sim.Spec.Config.ActiveDeadline)
+		if err != nil {
+			return nil, err
+		}
+		job.Spec.ActiveDeadlineSeconds = pointer.Int64Ptr(int64(deadline.Seconds()))
+	}
+
+	// Apply genesis patches in a dedicated step after the genesis is made available
+	if sim.Spec.Config.Genesis != nil && len(sim.Spec.Config.Genesis.Patches) > 0 {
+		patches, err := json.Marshal(sim.Spec.Config.Genesis.Patches)
+		if err != nil {
+			return nil, err
+		}
+
+		container := corev1.Container{
+			Name:    patchGenesisContainerName,
+			Image:   opts.ToolsImage,
+			Command: []string{"/manager", tools.PatchGenesisCommand, "-in", getGenesisSourcePath(sim), "-out", patchedGenesisPath},
+			Env: []corev1.EnvVar{
+				{
+					Name:  tools.GenesisPatchesEnv,
+					Value: string(patches),
+				},
+			},
+			VolumeMounts: []corev1.VolumeMount{
+				{
+					Name:      "data",
+					MountPath: "/workspace",
+				},
+			},
+		}
+		if sim.Spec.Config.Genesis.FromConfigMap != nil {
+			container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+				Name:      "genesis",
+				ReadOnly:  true,
+				MountPath: genesisMountPath,
+			})
+		}
+		job.Spec.Template.Spec.InitContainers = append(job.Spec.Template.Spec.InitContainers, container)
+	}
+
+	return job, nil
 }
 
-func getSimulationCmd(sim *toolsv1.Simulation, seed string) string {
+// getSimulationCmd returns the command running the test of the simulation
+// mode, exporting the simulation state and params if requested.
+func getSimulationCmd(sim *toolsv1.Simulation, cell matrixCell, seed string, export bool) string {
+	mode := getSimulationMode(sim)
 	cmd := fmt.Sprintf("go test %s ", sim.Spec.Target.Package)
 
-	if sim.Spec.Config.Benchmark {
-		cmd += fmt.Sprintf("-bench=%s -run=nothing ", sim.Spec.Config.Test)
+	if mode.benchmark {
+		cmd += fmt.Sprintf("-bench=%s -run=nothing %s", getSimulationTest(sim), getBenchmarkFlags(sim))
 	} else {
-		cmd += fmt.Sprintf("-run=%s ", sim.Spec.Config.Test)
+		cmd += fmt.Sprintf("-run=%s ", getSimulationTest(sim))
 	}
 
-	cmd += fmt.Sprintf("-Enabled=true -NumBlocks=%d -Verbose=true -Commit=true -BlockSize=%d"+
-		" -Seed=%s -Period=%d -v -timeout %s -ExportParamsPath /workspace/.tmp/params -ExportStatePath /workspace/.tmp/state",
-		sim.Spec.Config.Blocks, sim.Spec.Config.BlockSize, seed, sim.Spec.Config.Period, sim.Spec.Config.Timeout)
-	if sim.Spec.Config.Genesis != nil && sim.Spec.Config.Genesis.FromURL != "" {
-		cmd += " -Genesis=/workspace/.tmp/genesis.json"
-	} else if sim.Spec.Config.Genesis != nil && sim.Spec.Config.Genesis.FromConfigMap != nil {
-		cmd += fmt.Sprintf(" -Genesis=%s/%s", genesisMountPath, sim.Spec.Config.Genesis.FromConfigMap.Key)
+	cmd += fmt.Sprintf("-Enabled=true -NumBlocks=%d -Verbose=true -Commit=true -BlockSize=%d",
+		sim.Spec.Config.Blocks, sim.Spec.Config.BlockSize)
+	if mode.seeded {
+		cmd += fmt.Sprintf(" -Seed=%s", seed)
+	}
+	cmd += fmt.Sprintf(" -Period=%d -v -timeout %s", sim.Spec.Config.Period, sim.Spec.Config.Timeout)
+	cmd += getProfilingFlags(sim)
+	if export {
+		cmd += fmt.Sprintf(" -ExportParamsPath %s -ExportStatePath %s", paramsExportPath, stateExportPath)
+	}
+	if cell.previous != "" {
+		cmd += fmt.Sprintf(" -Genesis=%s", stateGenesisPath)
+		if cell.upgradeName != "" {
+			cmd += fmt.Sprintf(" -UpgradeName=%s", shellQuote(cell.upgradeName))
+		}
+	} else if sim.Spec.Config.Genesis != nil && len(sim.Spec.Config.Genesis.Patches) > 0 {
+		cmd += fmt.Sprintf(" -Genesis=%s", patchedGenesisPath)
+	} else if path := getGenesisSourcePath(sim); path != "" {
+		cmd += fmt.Sprintf(" -Genesis=%s", path)
 	}
 	return cmd
 }
+
+// getCloneCmd returns the command cloning the target repository, which reports
+// the commit checked out as the container termination message.
+func getCloneCmd(sim *toolsv1.Simulation) string {
+	return fmt.Sprintf("git clone --single-branch --depth 1 --branch %s %s /workspace && git -C /workspace rev-parse HEAD > /dev/termination-log",
+		shellQuote(sim.Spec.Target.Version), shellQuote(sim.Spec.Target.Repo))
+}
+
+// getArtifactsCmd returns the command uploading the simulation state and params
+// exported, and profiles written, once the simulation ends. It expects the start time and exit code
+// of the simulation in $start and $rc.
+func getArtifactsCmd(sim *toolsv1.Simulation, cell, seed string) string {
+	metadata := fmt.Sprintf(" -metadata %s -metadata %s -metadata %s",
+		shellQuote(seedMetadata+"="+seed),
+		shellQuote(repoMetadata+"="+sim.Spec.Target.Repo),
+		shellQuote(versionMetadata+"="+sim.Spec.Target.Version))
+	if cell != "" {
+		metadata += fmt.Sprintf(" -metadata %s", shellQuote(cellMetadata+"="+cell))
+	}
+	metadata += fmt.Sprintf(" -metadata %s=$(git rev-parse HEAD) -metadata %s=$status -metadata %s=$start -metadata %s=$(%s)",
+		commitMetadata, statusMetadata, startTimeMetadata, endTimeMetadata, dateCmd)
+
+	upload := func(contentType string, files []artifactFile, compressed bool) string {
+		cmd := fmt.Sprintf("%s %s -prefix %s -content-type %s%s",
+			toolsBinPath, tools.UploadArtifactsCommand, getArtifactsPrefix(sim, cell, seed), contentType, metadata)
+		if compressed {
+			cmd += " -compressed"
+		}
+		n := 0
+		for _, f := range files {
+			if f.compressed == compressed {
+				cmd += fmt.Sprintf(" %s=%s", f.name, f.path)
+				n++
+			}
+		}
+		if n == 0 {
+			return ""
+		}
+		return cmd + "; "
+	}
+
+	cmd := fmt.Sprintf("status=%s; [ $rc -eq 0 ] || status=%s; %s",
+		toolsv1.SimulationSucceed, toolsv1.SimulationFailed, upload("application/json", getArtifactFiles(), false))
+	profiles := getProfileFiles(sim)
+	cmd += upload("application/octet-stream", profiles, true)
+	cmd += upload("application/octet-stream", profiles, false)
+	return cmd
+}
+
+// shellQuote quotes s to be used as a single word in a shell command.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// getGenesisSourcePath returns the path where the genesis provided in spec is
+// available to the simulation, before any patches are applied.
+func getGenesisSourcePath(sim *toolsv1.Simulation) string {
+	switch {
+	case sim.Spec.Config.Genesis == nil:
+		return ""
+	case sim.Spec.Config.Genesis.FromURL != "":
+		return downloadedGenesisPath
+	case sim.Spec.Config.Genesis.FromConfigMap != nil:
+		return fmt.Sprintf("%s/%s", genesisMountPath, sim.Spec.Config.Genesis.FromConfigMap.Key)
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,146 @@
+package simulation
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+)
+
+func TestGetJobName(t *testing.T) {
+	sim := &toolsv1.Simulation{ObjectMeta: metav1.ObjectMeta{Name: "sim"}}
+	if name := getJobName(sim, "", "9071117693009442039"); name != "sim-9071117693009442039" {
+		t.Fatalf("wanted short names to be kept, got %s", name)
+	}
+
+	sim.Name = "cosmos-sdk-full-app-simulation-nightly-regression"
+	seeds := []string{"9071117693009442039", "9071117693009442038"}
+	names := make(map[string]bool)
+	for _, seed := range seeds {
+		name := getJobName(sim, "v0-45-x-bs400", seed)
+		if len(validation.IsDNS1123Label(name)) > 0 {
+			t.Fatalf("invalid job name %s", name)
+		}
+		if name != getJobName(sim, "v0-45-x-bs400", seed) {
+			t.Fatalf("wanted job names to be deterministic")
+		}
+		if !strings.HasPrefix(name, sim.Name) {
+			t.Fatalf("wanted job name to start with the simulation name, got %s", name)
+		}
+		names[name] = true
+	}
+	if len(names) != len(seeds) {
+		t.Fatalf("wanted distinct job names, got %v", names)
+	}
+}
+
+func TestGetJob(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = toolsv1.AddToScheme(scheme)
+
+	sim := &toolsv1.Simulation{ObjectMeta: metav1.ObjectMeta{Name: "sim", Namespace: "default", UID: "sim"}}
+	cell := matrixCell{Name: "bs100"}
+	owner := []metav1.OwnerReference{*metav1.NewControllerRef(sim, toolsv1.GroupVersion.WithKind("Simulation"))}
+
+	labelled, err := getJobSpec(sim, matrixCell{}, "1", defaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	celled, err := getJobSpec(sim, cell, "1", defaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Jobs created before they were labelled
+	legacy := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{
+		Name:            getJobName(sim, "", "2"),
+		Namespace:       sim.Namespace,
+		Labels:          map[string]string{NameLabelKey: sim.Name},
+		OwnerReferences: owner,
+	}}
+	// Jobs of other owners named as the job of a seed
+	foreign := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{
+		Name:      getJobName(sim, "", "4"),
+		Namespace: sim.Namespace,
+	}}
+
+	r := &SimulationReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme, labelled, celled, legacy, foreign),
+		log:    zap.New(),
+	}
+
+	job, err := r.GetJob(ctx, sim, "", "1")
+	if err != nil || job == nil || job.Name != labelled.Name {
+		t.Fatalf("wanted job %s, got %v %v", labelled.Name, job, err)
+	}
+	job, err = r.GetJob(ctx, sim, cell.Name, "1")
+	if err != nil || job == nil || job.Name != celled.Name {
+		t.Fatalf("wanted job %s, got %v %v", celled.Name, job, err)
+	}
+
+	job, err = r.GetJob(ctx, sim, "", "2")
+	if err != nil || job == nil || job.Labels[SeedLabelKey] != "2" || job.Annotations[SeedAnnotation] != "2" {
+		t.Fatalf("wanted legacy job to be labelled, got %v %v", job, err)
+	}
+
+	if err := r.MaybeDeleteJob(ctx, sim, cell.Name, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if job, err := r.GetJob(ctx, sim, cell.Name, "1"); err != nil || job != nil {
+		t.Fatalf("wanted job to be deleted, got %v %v", job, err)
+	}
+	if job, err := r.GetJob(ctx, sim, "", "3"); err != nil || job != nil {
+		t.Fatalf("wanted no job, got %v %v", job, err)
+	}
+	if job, err := r.GetJob(ctx, sim, "", "4"); err != nil || job != nil {
+		t.Fatalf("wanted job of another owner to be ignored, got %v %v", job, err)
+	}
+
+	// Long simulation names are shortened in label values
+	sim.Name = strings.Repeat("simulation-", 10)
+	for k, v := range getJobLabels(sim, "", "1") {
+		if len(validation.IsValidLabelValue(v)) > 0 {
+			t.Fatalf("invalid value %s of label %s", v, k)
+		}
+	}
+}
+
+func TestGetPodArtifactsCredentials(t *testing.T) {
+	opts := defaultOptions()
+	opts.LogBackupEnabled = true
+	opts.S3AccessKeyId = "operator-key"
+	opts.S3SecretAccessKey = "operator-secret"
+
+	// The credentials of the operator are not shared with simulation pods
+	for k, v := range getPodArtifactsEnv(opts) {
+		if v == opts.S3AccessKeyId || v == opts.S3SecretAccessKey {
+			t.Fatalf("wanted no operator credentials, got %s", k)
+		}
+	}
+
+	sim := &toolsv1.Simulation{ObjectMeta: metav1.ObjectMeta{Name: "sim"}}
+	sim.Spec.Artifacts.SecretRef = &corev1.LocalObjectReference{Name: "s3-credentials"}
+	sim.Spec.Artifacts.ServiceAccountName = "simulations"
+	job, err := getJobSpec(sim, matrixCell{}, "1", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	envFrom := job.Spec.Template.Spec.Containers[0].EnvFrom
+	if len(envFrom) != 2 || envFrom[1].SecretRef.Name != "s3-credentials" {
+		t.Fatalf("wanted credentials from the simulation secret, got %+v", envFrom)
+	}
+	if job.Spec.Template.Spec.ServiceAccountName != "simulations" {
+		t.Fatalf("wanted the simulation service account, got %s", job.Spec.Template.Spec.ServiceAccountName)
+	}
+}
@@ -2,67 +2,764 @@ package simulation
 
 import (
 	"bufio"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
-	"github.com/minio/minio-go/v7"
+	"github.com/go-logr/logr"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
-	"sigs.k8s.io/controller-runtime/pkg/client"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 
 	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
 )
 
-func (r *SimulationReconciler) backupJobLogs(ctx context.Context, sim *toolsv1.Simulation, job *batchv1.Job) error {
-	log := r.log.WithValues("simulations", sim.Name, "job", job.Name)
+const (
+	// Chunks are uploaded when they reach logChunkSize or after logFlushInterval.
+	logChunkSize     = 4 << 20
+	logFlushInterval = 5 * time.Minute
 
-	// Ignore if job has not finished yet
-	if job.Status.Succeeded == 0 && job.Status.Failed == 0 {
+	// Capturing is retried with an exponential backoff while the container runs.
+	logRetryInterval    = 10 * time.Second
+	logMaxRetryInterval = 5 * time.Minute
+	// logMaxRetries bounds the attempts to read the remaining logs of a
+	// terminated container, and to upload the complete log afterwards.
+	logMaxRetries = 5
+
+	logComposeWorkers = 4
+
+	// podRemovedLogError reports logs lost with a pod removed before any
+	// chunk was captured.
+	podRemovedLogError = "pod removed before logs were captured"
+
+	// Metadata stored with chunks and complete logs.
+	logChunksMetadata = "chunks"
+	logSha256Metadata = "sha256"
+	// logDigestMetadata identifies the chunks a complete log was composed
+	// from, as runs of a resumed seed capture their logs under the same key.
+	logDigestMetadata = "chunks-sha256"
+)
+
+// backupJobLogs captures the logs of the containers of the job pod, which
+// may be nil if the pod was not created yet or was already removed.
+func (r *SimulationReconciler) backupJobLogs(ctx context.Context, sim *toolsv1.Simulation, job *batchv1.Job, pod *corev1.Pod) error {
+	status := getJobStatus(sim, job.Name)
+	if status == nil || job.Spec.Selector == nil {
 		return nil
 	}
 
 	// Check if logs were already backed up
-	if _, ok := job.Annotations[LogBackupAnnotation]; ok {
+	if _, ok := job.Annotations[LogBackupAnnotation]; ok || status.LogsBackedUp {
+		status.LogsBackedUp = true
 		return nil
 	}
+	finished := job.Status.Succeeded > 0 || job.Status.Failed > 0
 
-	// Grab list of pods for the job
-	var jobPods corev1.PodList
-	if err := r.Client.List(ctx,
-		&jobPods,
-		client.InNamespace(sim.Namespace),
-		client.MatchingLabels(job.Spec.Selector.MatchLabels),
-	); err != nil {
-		return err
+	var containers []string
+	if pod != nil {
+		for _, c := range pod.Spec.InitContainers {
+			containers = append(containers, c.Name)
+		}
+		for _, c := range pod.Spec.Containers {
+			containers = append(containers, c.Name)
+		}
+	} else if finished {
+		// The pod is gone, but the chunks captured so far can still be uploaded
+		for _, l := range status.Logs {
+			containers = append(containers, l.Container)
+		}
+		if len(status.Logs) == 0 {
+			spec := job.Spec.Template.Spec
+			for _, c := range append(append([]corev1.Container{}, spec.InitContainers...), spec.Containers...) {
+				getContainerLogStatus(status, c.Name).Error = podRemovedLogError
+			}
+		}
+	}
+
+	// Pods are not created yet
+	if len(containers) == 0 && !finished {
+		return nil
+	}
+
+	prefix := getArtifactsPrefix(sim, status.Cell, status.Seed)
+	metadata := getObjectMetadata(sim, status)
+	complete := true
+	for _, c := range containers {
+		started := pod == nil || containerStarted(pod, c)
+		progress := findContainerLogStatus(status, c)
+
+		// Containers which never ran, e.g. after an init container failed,
+		// have no logs
+		if !started && (progress == nil || progress.Chunks == 0) {
+			complete = complete && finished
+			continue
+		}
+
+		if progress == nil {
+			progress = getContainerLogStatus(status, c)
+		}
+		if !progress.Complete && progress.Error == "" {
+			// Chunks captured before are composed right away
+			syncPod := pod
+			if !started {
+				syncPod = nil
+			}
+			*progress = r.logs.Sync(sim, syncPod, c, prefix, metadata, *progress)
+		}
+
+		// Logs which could not be backed up are reported by the simulation
+		// condition instead of holding up the job
+		complete = complete && (progress.Complete || progress.Error != "")
+	}
+
+	// Ignore if job has not finished yet
+	if !complete || !finished {
+		return nil
+	}
+
+	status.LogsBackedUp = true
+	if job.Annotations == nil {
+		job.Annotations = make(map[string]string)
+	}
+	job.Annotations[LogBackupAnnotation] = "true"
+	return r.Update(ctx, job)
+}
+
+// updateLogBackupCondition reports the containers whose logs could not be
+// backed up.
+func updateLogBackupCondition(sim *toolsv1.Simulation) {
+	var failed []string
+	for _, s := range sim.Status.JobStatus {
+		for _, l := range s.Logs {
+			if l.Error != "" {
+				failed = append(failed, fmt.Sprintf("%s/%s", s.Name, l.Container))
+			}
+		}
+	}
+
+	if len(failed) > 0 {
+		setCondition(sim, toolsv1.LogBackupFailed, corev1.ConditionTrue, "UploadFailed",
+			fmt.Sprintf("could not back up the logs of %s", strings.Join(failed, ", ")))
+	} else if getCondition(sim, toolsv1.LogBackupFailed) != nil {
+		setCondition(sim, toolsv1.LogBackupFailed, corev1.ConditionFalse, "BackedUp", "")
+	}
+}
+
+func findContainerLogStatus(status *toolsv1.JobStatus, container string) *toolsv1.ContainerLogStatus {
+	for i, l := range status.Logs {
+		if l.Container == container {
+			return &status.Logs[i]
+		}
+	}
+	return nil
+}
+
+func getContainerLogStatus(status *toolsv1.JobStatus, container string) *toolsv1.ContainerLogStatus {
+	if l := findContainerLogStatus(status, container); l != nil {
+		return l
+	}
+	status.Logs = append(status.Logs, toolsv1.ContainerLogStatus{Container: container})
+	return &status.Logs[len(status.Logs)-1]
+}
+
+// getPodContainerStatus returns the status of the container or init container
+// of the pod, if any.
+func getPodContainerStatus(pod *corev1.Pod, container string) *corev1.ContainerStatus {
+	for _, statuses := range [][]corev1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+		for i, cs := range statuses {
+			if cs.Name == container {
+				return &statuses[i]
+			}
+		}
+	}
+	return nil
+}
+
+// containerStarted returns whether the container ran. Containers terminated
+// before they could start, e.g. when the pod was deleted, never ran.
+func containerStarted(pod *corev1.Pod, container string) bool {
+	cs := getPodContainerStatus(pod, container)
+	if cs == nil {
+		return false
+	}
+	return cs.State.Running != nil || (cs.State.Terminated != nil && !cs.State.Terminated.StartedAt.IsZero())
+}
+
+func containerTerminated(pod *corev1.Pod, container string) *corev1.ContainerStateTerminated {
+	if cs := getPodContainerStatus(pod, container); cs != nil {
+		return cs.State.Terminated
+	}
+	return nil
+}
+
+// logShipper captures the logs of simulation containers while they run,
+// uploading them in chunks which are composed into a single object, in order,
+// once the container terminates. Composing is done by a pool of workers with a
+// rate limited queue, so failed uploads are retried with a backoff without
+// holding up reconciles.
+type logShipper struct {
+	log       logr.Logger
+	clientset kubernetes.Interface
+	store     ArtifactStore
+	events    chan event.GenericEvent
+	queue     workqueue.RateLimitingInterface
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	streams map[string]*logStream
+}
+
+type logStream struct {
+	sim       types.NamespacedName
+	namespace string
+	pod       string
+	container string
+	prefix    string
+	uid       types.UID
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	metadata map[string]string
+	followed bool
+	progress toolsv1.ContainerLogStatus
+	done     bool
+}
+
+func newLogShipper(log logr.Logger, clientset kubernetes.Interface, store ArtifactStore) *logShipper {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &logShipper{
+		log:       log,
+		clientset: clientset,
+		store:     store,
+		events:    make(chan event.GenericEvent, 1024),
+		queue: workqueue.NewNamedRateLimitingQueue(
+			workqueue.NewItemExponentialFailureRateLimiter(5*time.Second, 5*time.Minute),
+			"logs",
+		),
+		ctx:     ctx,
+		cancel:  cancel,
+		streams: make(map[string]*logStream),
+	}
+}
+
+// Start runs the workers composing logs until stop is closed, and stops all
+// streams afterwards.
+func (s *logShipper) Start(stop <-chan struct{}) error {
+	for i := 0; i < logComposeWorkers; i++ {
+		go wait.Until(func() {
+			for s.processNextItem() {
+			}
+		}, time.Second, stop)
+	}
+
+	<-stop
+	s.cancel()
+	s.queue.ShutDown()
+	return nil
+}
+
+// Sync starts capturing the logs of the container, resuming from progress, if
+// it is not being captured yet and returns the current progress. When pod is
+// nil the chunks captured so far are composed right away. The metadata is
+// stored with the complete log.
+func (s *logShipper) Sync(sim *toolsv1.Simulation, pod *corev1.Pod, container, prefix string, metadata map[string]string, progress toolsv1.ContainerLogStatus) toolsv1.ContainerLogStatus {
+	key := getLogKey(prefix, container)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.streams[key]
+
+	// Stop capturing the logs of a previous run of the seed, e.g. one
+	// interrupted when the simulation was suspended
+	if ok && pod != nil && st.uid != "" && st.uid != pod.UID {
+		st.cancel()
+		ok = false
+	}
+
+	if !ok {
+		st = &logStream{
+			sim:       types.NamespacedName{Namespace: sim.Namespace, Name: sim.Name},
+			namespace: sim.Namespace,
+			container: container,
+			prefix:    prefix,
+			metadata:  metadata,
+			progress:  progress,
+		}
+		st.ctx, st.cancel = context.WithCancel(s.ctx)
+		s.streams[key] = st
+
+		if pod != nil {
+			st.pod, st.uid = pod.Name, pod.UID
+			go s.run(key, st)
+		} else {
+			st.followed = true
+			s.queue.Add(key)
+		}
 	}
 
-	if len(jobPods.Items) == 0 {
-		return fmt.Errorf("job %q has no pods", job.Name)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.done {
+		delete(s.streams, key)
 	}
-	pod := jobPods.Items[0]
+	return st.progress
+}
+
+// Stop stops capturing the logs of the simulation, e.g. before its artifacts
+// are deleted.
+func (s *logShipper) Stop(sim *toolsv1.Simulation) {
+	name := types.NamespacedName{Namespace: sim.Namespace, Name: sim.Name}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, st := range s.streams {
+		if st.sim == name {
+			st.cancel()
+			delete(s.streams, key)
+		}
+	}
+}
 
-	for _, container := range []string{simulationContainerName, stateContainerName, paramsContainerName} {
-		log.WithValues("container", container).Info("backing up logs")
+// run follows the logs until the container terminates and queues the stream
+// to be composed afterwards.
+func (s *logShipper) run(key string, st *logStream) {
+	log := s.log.WithValues("pod", st.pod, "container", st.container)
+	log.Info("capturing logs")
+
+	retries := 0
+	delay := logRetryInterval
+	for {
+		err := s.follow(st)
+		if st.ctx.Err() != nil {
+			return
+		}
+
+		pod, getErr := s.clientset.CoreV1().Pods(st.namespace).Get(st.pod, metav1.GetOptions{})
+		gone := errors.IsNotFound(getErr)
+		var state *corev1.ContainerStateTerminated
+		if getErr == nil {
+			state = containerTerminated(pod, st.container)
+		}
+		terminated := gone || state != nil
 
-		logs, err := r.clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{Container: container}).Stream()
 		if err != nil {
+			log.Error(err, "error capturing logs")
+		} else {
+			delay = logRetryInterval
+		}
+
+		if terminated {
+			retries++
+		}
+		if terminated && (err == nil || gone || retries > logMaxRetries) {
+			if state != nil {
+				st.setTerminated(state)
+			}
+			break
+		}
+
+		select {
+		case <-st.ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > logMaxRetryInterval {
+			delay = logMaxRetryInterval
+		}
+	}
+
+	st.mu.Lock()
+	st.followed = true
+	st.mu.Unlock()
+	s.queue.Add(key)
+}
+
+func (s *logShipper) processNextItem() bool {
+	item, quit := s.queue.Get()
+	if quit {
+		return false
+	}
+	defer s.queue.Done(item)
+	key := item.(string)
+
+	s.mu.Lock()
+	st := s.streams[key]
+	s.mu.Unlock()
+
+	// The stream may have been replaced by one still being followed
+	if st == nil || !st.isFollowed() {
+		s.queue.Forget(key)
+		return true
+	}
+
+	log := s.log.WithValues("key", key)
+	err := s.compose(st)
+	switch {
+	case err == nil:
+		log.Info("logs captured")
+		s.queue.Forget(key)
+	case s.queue.NumRequeues(key) < logMaxRetries:
+		log.Error(err, "error composing logs")
+		s.queue.AddRateLimited(key)
+	default:
+		log.Error(err, "giving up composing logs")
+		s.queue.Forget(key)
+
+		st.mu.Lock()
+		st.progress.Error = err.Error()
+		st.done = true
+		st.mu.Unlock()
+		s.notify(st)
+	}
+	return true
+}
+
+// follow streams the container logs after the last captured line, uploading
+// chunks as they fill up, until the stream ends.
+func (s *logShipper) follow(st *logStream) error {
+	st.mu.Lock()
+	progress := st.progress
+	st.mu.Unlock()
+
+	opts := &corev1.PodLogOptions{
+		Container:  st.container,
+		Follow:     true,
+		Timestamps: true,
+	}
+
+	var last time.Time
+	if progress.LastTimestamp != "" {
+		var err error
+		if last, err = time.Parse(time.RFC3339Nano, progress.LastTimestamp); err != nil {
 			return err
 		}
+		opts.SinceTime = &metav1.Time{Time: last.Truncate(time.Second)}
+	}
 
-		reader := bufio.NewReader(logs)
-		_, err = r.minio.PutObject(ctx,
-			r.opts.LogsBucketName,
-			fmt.Sprintf("%s/%s/%s.log", sim.Name, job.Annotations[SeedAnnotation], container),
-			reader,
-			-1,
-			minio.PutObjectOptions{ContentType: "text/plain"},
-		)
-		_ = logs.Close()
-		if err != nil {
+	logs, err := s.clientset.CoreV1().Pods(st.namespace).GetLogs(st.pod, opts).Context(st.ctx).Stream()
+	if err != nil {
+		return err
+	}
+	defer logs.Close()
+
+	var (
+		chunk     bytes.Buffer
+		flushedAt = time.Now()
+		skipped   int
+		current   = last
+		lines     = progress.LastTimestampLines
+	)
+
+	// Chunks are written under their index, so a chunk whose upload failed, or
+	// whose progress was not recorded, is overwritten when capture resumes.
+	flush := func() error {
+		if chunk.Len() == 0 {
+			return nil
+		}
+		sum := sha256.Sum256(chunk.Bytes())
+		if err := s.store.Put(st.ctx, getLogChunkKey(st.prefix, st.container, progress.Chunks), &chunk, PutOptions{
+			ContentType: "text/plain",
+			Metadata:    map[string]string{logSha256Metadata: hex.EncodeToString(sum[:])},
+		}); err != nil {
 			return err
 		}
+		chunk.Reset()
+		flushedAt = time.Now()
+
+		progress.Chunks++
+		progress.LastTimestamp = current.Format(time.RFC3339Nano)
+		progress.LastTimestampLines = lines
+
+		st.mu.Lock()
+		st.progress = progress
+		st.mu.Unlock()
+		s.notify(st)
+		return nil
 	}
 
-	job.Annotations[LogBackupAnnotation] = "true"
-	return r.Update(ctx, job)
+	reader := bufio.NewReader(logs)
+	for {
+		line, readErr := reader.ReadString('\n')
+		if line != "" {
+			ts, msg := splitLogTimestamp(line)
+
+			// Skip lines captured before resuming
+			switch {
+			case ts.Before(last):
+				continue
+			case ts.Equal(last) && skipped < progress.LastTimestampLines:
+				skipped++
+				continue
+			}
+
+			if ts.Equal(current) {
+				lines++
+			} else {
+				current, lines = ts, 1
+			}
+			chunk.WriteString(msg)
+
+			if chunk.Len() >= logChunkSize || time.Since(flushedAt) >= logFlushInterval {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+
+		if readErr != nil {
+			if err := flush(); err != nil {
+				return err
+			}
+			if readErr == io.EOF {
+				return nil
+			}
+			return readErr
+		}
+	}
+}
+
+// compose uploads the complete log, concatenating every chunk in order, and
+// removes the chunks afterwards. It is idempotent: a complete log uploaded by
+// a previous attempt from the same chunks is kept.
+func (s *logShipper) compose(st *logStream) error {
+	st.mu.Lock()
+	progress := st.progress
+	st.mu.Unlock()
+
+	key := getLogKey(st.prefix, st.container)
+	digest, err := s.digest(st, progress.Chunks)
+	if err != nil {
+		return err
+	}
+
+	info, err := s.store.Stat(st.ctx, key)
+	switch {
+	case err == nil && info.Metadata[logChunksMetadata] == strconv.Itoa(progress.Chunks) &&
+		(digest == "" || info.Metadata[logDigestMetadata] == digest):
+		// Only the removal of the chunks is missing
+		if progress.Size, progress.Sha256, err = s.checksum(st.ctx, key); err != nil {
+			return err
+		}
+	case err == nil || err == ErrArtifactNotFound:
+		if progress.Size, progress.Sha256, err = s.concat(st, progress.Chunks, digest); err != nil {
+			return err
+		}
+	default:
+		return err
+	}
+
+	// Chunks above the count, captured before a restart without their
+	// progress being recorded, are removed as well
+	chunks, err := s.store.List(st.ctx, getLogChunksPrefix(st.prefix, st.container))
+	if err != nil {
+		return err
+	}
+	for _, c := range chunks {
+		if err := s.store.Delete(st.ctx, c.Key); err != nil {
+			return err
+		}
+	}
+
+	progress.Complete = true
+	progress.Key = key
+	progress.Error = ""
+
+	st.mu.Lock()
+	st.progress = progress
+	st.done = true
+	st.mu.Unlock()
+	s.notify(st)
+	return nil
+}
+
+// digest returns a digest of the checksums of the chunks, identifying the run
+// of the container they were captured from, or an empty string if the chunks
+// were removed once composed.
+func (s *logShipper) digest(st *logStream, chunks int) (string, error) {
+	hash := sha256.New()
+	for i := 0; i < chunks; i++ {
+		info, err := s.store.Stat(st.ctx, getLogChunkKey(st.prefix, st.container, i))
+		if err == ErrArtifactNotFound {
+			return "", nil
+		} else if err != nil {
+			return "", err
+		}
+		fmt.Fprintln(hash, info.Metadata[logSha256Metadata])
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// concat uploads the chunks as a single gzip compressed object, verifying the
+// checksum of each chunk, and returns its size and checksum.
+func (s *logShipper) concat(st *logStream, chunks int, digest string) (int64, string, error) {
+	key := getLogKey(st.prefix, st.container)
+	hash := sha256.New()
+	counter := &countingWriter{}
+
+	st.mu.Lock()
+	metadata := map[string]string{logChunksMetadata: strconv.Itoa(chunks), logDigestMetadata: digest}
+	for k, v := range st.metadata {
+		metadata[k] = v
+	}
+	st.mu.Unlock()
+
+	pr, pw := io.Pipe()
+	go func() {
+		gz := gzip.NewWriter(io.MultiWriter(pw, hash, counter))
+		for i := 0; i < chunks; i++ {
+			if err := s.copyChunk(st.ctx, gz, getLogChunkKey(st.prefix, st.container, i)); err != nil {
+				_ = pw.CloseWithError(err)
+				return
+			}
+		}
+		_ = pw.CloseWithError(gz.Close())
+	}()
+
+	err := s.store.Put(st.ctx, key, pr, PutOptions{
+		ContentType:     "text/plain",
+		ContentEncoding: "gzip",
+		Metadata:        metadata,
+	})
+	_ = pr.CloseWithError(err)
+	if err != nil {
+		return 0, "", err
+	}
+
+	// Make sure the object was stored completely before removing the chunks
+	info, err := s.store.Stat(st.ctx, key)
+	if err != nil {
+		return 0, "", err
+	}
+	if info.Size != counter.n {
+		return 0, "", fmt.Errorf("stored %d bytes out of %d", info.Size, counter.n)
+	}
+	return counter.n, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (s *logShipper) copyChunk(ctx context.Context, w io.Writer, key string) error {
+	info, err := s.store.Stat(ctx, key)
+	if err != nil {
+		return fmt.Errorf("chunk %s: %v", key, err)
+	}
+
+	rc, err := s.store.Get(ctx, key)
+	if err != nil {
+		return fmt.Errorf("chunk %s: %v", key, err)
+	}
+	defer rc.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(w, hash), rc); err != nil {
+		return err
+	}
+
+	if want := info.Metadata[logSha256Metadata]; want != "" && want != hex.EncodeToString(hash.Sum(nil)) {
+		return fmt.Errorf("chunk %s: checksum mismatch", key)
+	}
+	return nil
+}
+
+// checksum returns the size and checksum of the object stored under key.
+func (s *logShipper) checksum(ctx context.Context, key string) (int64, string, error) {
+	rc, err := s.store.Get(ctx, key)
+	if err != nil {
+		return 0, "", err
+	}
+	defer rc.Close()
+
+	hash := sha256.New()
+	n, err := io.Copy(hash, rc)
+	if err != nil {
+		return 0, "", err
+	}
+	return n, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (st *logStream) isFollowed() bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.followed
+}
+
+// setTerminated records the result of the container in the metadata of the log.
+func (st *logStream) setTerminated(state *corev1.ContainerStateTerminated) {
+	status := toolsv1.SimulationSucceed
+	if state.ExitCode != 0 {
+		status = toolsv1.SimulationFailed
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	metadata := map[string]string{
+		statusMetadata:    string(status),
+		startTimeMetadata: state.StartedAt.UTC().Format(time.RFC3339),
+		endTimeMetadata:   state.FinishedAt.UTC().Format(time.RFC3339),
+	}
+	for k, v := range st.metadata {
+		metadata[k] = v
+	}
+	st.metadata = metadata
+}
+
+func (s *logShipper) notify(st *logStream) {
+	sim := &toolsv1.Simulation{ObjectMeta: metav1.ObjectMeta{Namespace: st.sim.Namespace, Name: st.sim.Name}}
+	select {
+	case s.events <- event.GenericEvent{Meta: sim, Object: sim}:
+	case <-s.ctx.Done():
+	}
+}
+
+// splitLogTimestamp splits a log line requested with timestamps into the
+// timestamp and the original line.
+func splitLogTimestamp(line string) (time.Time, string) {
+	i := strings.IndexByte(line, ' ')
+	if i < 0 {
+		return time.Time{}, line
+	}
+	ts, err := time.Parse(time.RFC3339Nano, line[:i])
+	if err != nil {
+		return time.Time{}, line
+	}
+	return ts, line[i+1:]
+}
+
+func getLogKey(prefix, container string) string {
+	return fmt.Sprintf("%s/%s.log.gz", prefix, container)
+}
+
+func getLogChunksPrefix(prefix, container string) string {
+	return fmt.Sprintf("%s/%s.log.parts/", prefix, container)
+}
+
+func getLogChunkKey(prefix, container string, i int) string {
+	return fmt.Sprintf("%s%06d", getLogChunksPrefix(prefix, container), i)
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
 }
@@ -0,0 +1,254 @@
+package simulation
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+)
+
+func TestLogShipperCompose(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	s := newLogShipper(zap.New(), nil, store)
+	defer s.cancel()
+
+	// The last chunk was captured before a restart, without its progress
+	for i, chunk := range []string{"line 1\n", "line 2\nline 3\n", "line 4\n"} {
+		if err := store.Put(ctx, getLogChunkKey("sim/1", "simulation", i), strings.NewReader(chunk), PutOptions{}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// Drain notifications sent to reconcile the simulation
+	go func() {
+		for range s.events {
+		}
+	}()
+
+	st := &logStream{
+		ctx:       ctx,
+		prefix:    "sim/1",
+		container: "simulation",
+		metadata:  map[string]string{seedMetadata: "1"},
+		progress:  toolsv1.ContainerLogStatus{Chunks: 2},
+	}
+	st.setTerminated(&corev1.ContainerStateTerminated{ExitCode: 1})
+	if err := s.compose(st); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !st.done || !st.progress.Complete || st.progress.Key != "sim/1/simulation.log.gz" {
+		t.Fatalf("wanted complete progress, got %+v", st.progress)
+	}
+
+	rc, err := store.Get(ctx, "sim/1/simulation.log.gz")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	gz, err := gzip.NewReader(rc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, _ := ioutil.ReadAll(gz)
+	if string(data) != "line 1\nline 2\nline 3\n" {
+		t.Fatalf("unexpected log %q", data)
+	}
+
+	info, err := store.Stat(ctx, "sim/1/simulation.log.gz")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.Metadata[seedMetadata] != "1" || info.Metadata[statusMetadata] != "Failed" {
+		t.Fatalf("unexpected metadata %v", info.Metadata)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := store.Stat(ctx, getLogChunkKey("sim/1", "simulation", i)); err != ErrArtifactNotFound {
+			t.Fatalf("wanted chunk %d to be removed, got %v", i, err)
+		}
+	}
+
+	if st.progress.Size != info.Size || st.progress.Sha256 == "" {
+		t.Fatalf("wanted size and checksum, got %+v", st.progress)
+	}
+
+	// Composing again, e.g. after a restart before the progress was recorded,
+	// keeps the complete log even though the chunks are gone.
+	retry := &logStream{ctx: ctx, prefix: "sim/1", container: "simulation", progress: toolsv1.ContainerLogStatus{Chunks: 2}}
+	if err := s.compose(retry); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if retry.progress.Sha256 != st.progress.Sha256 || retry.progress.Size != st.progress.Size {
+		t.Fatalf("wanted %+v, got %+v", st.progress, retry.progress)
+	}
+}
+
+func TestLogShipperComposeResumedRun(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	s := newLogShipper(zap.New(), nil, store)
+	defer s.cancel()
+
+	go func() {
+		for range s.events {
+		}
+	}()
+
+	// Both runs of the seed capture as many chunks under the same prefix
+	for _, line := range []string{"run 1\n", "run 2\n"} {
+		sum := sha256.Sum256([]byte(line))
+		if err := store.Put(ctx, getLogChunkKey("sim/1", "simulation", 0), strings.NewReader(line), PutOptions{
+			Metadata: map[string]string{logSha256Metadata: hex.EncodeToString(sum[:])},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		st := &logStream{ctx: ctx, prefix: "sim/1", container: "simulation", progress: toolsv1.ContainerLogStatus{Chunks: 1}}
+		if err := s.compose(st); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rc, err := store.Get(ctx, "sim/1/simulation.log.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz, err := gzip.NewReader(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadAll(gz); string(data) != "run 2\n" {
+		t.Fatalf("wanted the log of the last run, got %q", data)
+	}
+}
+
+func TestLogShipperComposeChecksumMismatch(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	s := newLogShipper(zap.New(), nil, store)
+	defer s.cancel()
+
+	if err := store.Put(ctx, getLogChunkKey("sim/1", "simulation", 0), strings.NewReader("line 1\n"), PutOptions{
+		Metadata: map[string]string{logSha256Metadata: "0000"},
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	st := &logStream{ctx: ctx, prefix: "sim/1", container: "simulation", progress: toolsv1.ContainerLogStatus{Chunks: 1}}
+	if err := s.compose(st); err == nil {
+		t.Fatalf("wanted checksum error")
+	}
+
+	if st.done || st.progress.Complete {
+		t.Fatalf("wanted incomplete progress, got %+v", st.progress)
+	}
+
+	// Chunks are kept for the next attempt
+	if _, err := store.Stat(ctx, getLogChunkKey("sim/1", "simulation", 0)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestBackupJobLogsGivenUp(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = toolsv1.AddToScheme(scheme)
+
+	sim := &toolsv1.Simulation{ObjectMeta: metav1.ObjectMeta{Name: "sim", Namespace: "default"}}
+	setJobStatus(sim, matrixCell{}, "1", toolsv1.SimulationFailed)
+	status := getJobStatus(sim, getJobName(sim, "", "1"))
+	status.Logs = []toolsv1.ContainerLogStatus{{Container: cloneContainerName, Error: "upload failed"}}
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: status.Name, Namespace: sim.Namespace},
+		Spec:       batchv1.JobSpec{Selector: &metav1.LabelSelector{}},
+		Status:     batchv1.JobStatus{Failed: 1},
+	}
+	r := &SimulationReconciler{Client: fake.NewFakeClientWithScheme(scheme, job)}
+
+	// The clone failed, so the simulation container never ran
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{{Name: cloneContainerName}},
+			Containers:     []corev1.Container{{Name: simulationContainerName}},
+		},
+		Status: corev1.PodStatus{
+			InitContainerStatuses: []corev1.ContainerStatus{{Name: cloneContainerName, State: corev1.ContainerState{
+				Terminated: &corev1.ContainerStateTerminated{ExitCode: 128, StartedAt: metav1.Now()},
+			}}},
+			ContainerStatuses: []corev1.ContainerStatus{{Name: simulationContainerName, State: corev1.ContainerState{
+				Waiting: &corev1.ContainerStateWaiting{Reason: "PodInitializing"},
+			}}},
+		},
+	}
+	if err := r.backupJobLogs(context.Background(), sim, job, pod); err != nil {
+		t.Fatal(err)
+	}
+	if !status.LogsBackedUp || len(status.Logs) != 1 {
+		t.Fatalf("wanted logs to be given up, got %+v", status.Logs)
+	}
+
+	updateLogBackupCondition(sim)
+	if c := getCondition(sim, toolsv1.LogBackupFailed); c == nil || c.Status != corev1.ConditionTrue {
+		t.Fatalf("wanted the failed backup to be reported, got %+v", c)
+	}
+}
+
+func TestBackupJobLogsPodRemoved(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = toolsv1.AddToScheme(scheme)
+
+	sim := &toolsv1.Simulation{ObjectMeta: metav1.ObjectMeta{Name: "sim", Namespace: "default"}}
+	setJobStatus(sim, matrixCell{}, "1", toolsv1.SimulationSucceed)
+	status := getJobStatus(sim, getJobName(sim, "", "1"))
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: status.Name, Namespace: sim.Namespace},
+		Spec: batchv1.JobSpec{Selector: &metav1.LabelSelector{}, Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{{Name: cloneContainerName}},
+			Containers:     []corev1.Container{{Name: simulationContainerName}},
+		}}},
+		Status: batchv1.JobStatus{Succeeded: 1},
+	}
+	r := &SimulationReconciler{Client: fake.NewFakeClientWithScheme(scheme, job)}
+
+	// The pod was removed before any log was captured
+	if err := r.backupJobLogs(context.Background(), sim, job, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Logs) != 2 || status.Logs[1].Container != simulationContainerName || status.Logs[1].Error != podRemovedLogError {
+		t.Fatalf("wanted lost logs to be reported, got %+v", status.Logs)
+	}
+
+	updateLogBackupCondition(sim)
+	if c := getCondition(sim, toolsv1.LogBackupFailed); c == nil || c.Status != corev1.ConditionTrue {
+		t.Fatalf("wanted the lost logs to be reported, got %+v", c)
+	}
+}
+
+func TestSplitLogTimestamp(t *testing.T) {
+	ts, line := splitLogTimestamp("2020-10-18T23:47:00.123456789Z block 1\n")
+	if ts.Nanosecond() != 123456789 || line != "block 1\n" {
+		t.Fatalf("unexpected split %v %q", ts, line)
+	}
+
+	ts, line = splitLogTimestamp("no timestamp\n")
+	if !ts.IsZero() || line != "no timestamp\n" {
+		t.Fatalf("unexpected split %v %q", ts, line)
+	}
+}
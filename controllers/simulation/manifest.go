@@ -0,0 +1,190 @@
+package simulation
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+)
+
+// manifest summarises a simulation sweep, so that it can be consumed without
+// listing the artifact store.
+type manifest struct {
+	Name        string             `json:"name"`
+	Namespace   string             `json:"namespace"`
+	Target      toolsv1.TargetSpec `json:"target"`
+	Status      toolsv1.SimStatus  `json:"status"`
+	Seeds       []manifestSeed     `json:"seeds"`
+	GeneratedAt time.Time          `json:"generatedAt"`
+}
+
+type manifestSeed struct {
+	Seed       string              `json:"seed"`
+	Stage      string              `json:"stage,omitempty"`
+	Cell       string              `json:"cell,omitempty"`
+	Parameters map[string]string   `json:"parameters,omitempty"`
+	Job        string              `json:"job"`
+	Status     toolsv1.SimStatus   `json:"status"`
+	Reason     string              `json:"reason,omitempty"`
+	Message    string              `json:"message,omitempty"`
+	Failure    toolsv1.FailureType `json:"failureType,omitempty"`
+	Commit     string              `json:"commit,omitempty"`
+	StateHash  string              `json:"stateHash,omitempty"`
+	Logs       []manifestObject    `json:"logs"`
+	Artifacts  []manifestObject    `json:"artifacts"`
+	Profiles   []manifestObject    `json:"profiles,omitempty"`
+}
+
+type manifestObject struct {
+	Name   string `json:"name"`
+	Key    string `json:"key"`
+	URL    string `json:"url"`
+	Size   int64  `json:"size"`
+	Sha256 string `json:"sha256,omitempty"`
+}
+
+// updateManifest writes the manifest of the simulation once every job finished
+// and its artifacts were uploaded. The manifest is written again whenever its
+// contents change, e.g. when the benchmarks are compared with the baseline or
+// when jobs run after it was written.
+func (r *SimulationReconciler) updateManifest(ctx context.Context, sim *toolsv1.Simulation) error {
+	if !manifestReady(sim) {
+		sim.Status.Manifest = nil
+		sim.Status.ManifestDigest = ""
+		return nil
+	}
+
+	m := getManifest(sim, r.store)
+	digest, err := m.digest()
+	if err != nil {
+		return err
+	}
+
+	// Check if the manifest was already written
+	if sim.Status.Manifest != nil && sim.Status.ManifestDigest == digest {
+		return nil
+	}
+
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	key := getManifestKey(sim)
+	if err := r.store.Put(ctx, key, bytes.NewReader(b), PutOptions{ContentType: "application/json"}); err != nil {
+		return err
+	}
+
+	sim.Status.Manifest = &toolsv1.Artifact{
+		Name: manifestName,
+		Key:  key,
+		URL:  r.store.URL(key),
+		Size: int64(len(b)),
+	}
+	sim.Status.ManifestDigest = digest
+	return nil
+}
+
+// digest returns a digest of the contents of the manifest, regardless of when
+// it was generated.
+func (m manifest) digest() (string, error) {
+	m.GeneratedAt = time.Time{}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(b)), nil
+}
+
+// manifestReady returns whether all jobs finished and the upload of their logs
+// and artifacts is over.
+func manifestReady(sim *toolsv1.Simulation) bool {
+	if len(sim.Status.JobStatus) == 0 {
+		return false
+	}
+
+	for _, s := range sim.Status.JobStatus {
+		if !isJobFinished(s.Status) && s.Status != toolsv1.SimulationCancelled {
+			return false
+		}
+		// Artifacts are not reported again once the job is deleted, and
+		// cancelled seeds may never have run. Their artifacts are added to
+		// the manifest if they are collected later on.
+		if !s.ArtifactsCollected && !s.JobDeleted && s.Status != toolsv1.SimulationSkipped && s.Status != toolsv1.SimulationCancelled {
+			return false
+		}
+		for _, l := range s.Logs {
+			if !l.Complete && l.Error == "" {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func getManifest(sim *toolsv1.Simulation, store ArtifactStore) *manifest {
+	m := &manifest{
+		Name:        sim.Name,
+		Namespace:   sim.Namespace,
+		Target:      sim.Spec.Target,
+		Status:      sim.Status.Status,
+		Seeds:       make([]manifestSeed, 0, len(sim.Status.JobStatus)),
+		GeneratedAt: time.Now().UTC(),
+	}
+
+	for _, s := range sim.Status.JobStatus {
+		seed := manifestSeed{
+			Seed:       s.Seed,
+			Stage:      s.Stage,
+			Cell:       s.Cell,
+			Parameters: s.Parameters,
+			Job:        s.Name,
+			Status:     s.Status,
+			Reason:     s.Reason,
+			Message:    s.Message,
+			Failure:    s.FailureType,
+			Commit:     s.Commit,
+			StateHash:  s.StateHash,
+			Logs:       make([]manifestObject, 0, len(s.Logs)),
+			Artifacts:  make([]manifestObject, 0, len(s.Artifacts)),
+		}
+		for _, l := range s.Logs {
+			if !l.Complete {
+				continue
+			}
+			seed.Logs = append(seed.Logs, manifestObject{
+				Name:   l.Container,
+				Key:    l.Key,
+				URL:    store.URL(l.Key),
+				Size:   l.Size,
+				Sha256: l.Sha256,
+			})
+		}
+		for _, a := range s.Artifacts {
+			seed.Artifacts = append(seed.Artifacts, manifestObject{
+				Name: a.Name,
+				Key:  a.Key,
+				URL:  a.URL,
+				Size: a.Size,
+			})
+		}
+		for _, a := range s.Profiles {
+			seed.Profiles = append(seed.Profiles, manifestObject{
+				Name: a.Name,
+				Key:  a.Key,
+				URL:  a.URL,
+				Size: a.Size,
+			})
+		}
+		m.Seeds = append(m.Seeds, seed)
+	}
+	return m
+}
+
+func getManifestKey(sim *toolsv1.Simulation) string {
+	return getArtifactsRoot(sim.Namespace, sim.Name) + manifestName
+}
@@ -0,0 +1,127 @@
+package simulation
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+)
+
+func TestUpdateManifest(t *testing.T) {
+	store := newMemoryStore()
+	r := &SimulationReconciler{store: store}
+
+	sim := &toolsv1.Simulation{
+		ObjectMeta: metav1.ObjectMeta{Name: "sim", Namespace: "default"},
+		Status: toolsv1.SimulationStatus{
+			Status: toolsv1.SimulationFailed,
+			JobStatus: []toolsv1.JobStatus{
+				{
+					Name:               "sim-1",
+					Seed:               "1",
+					Status:             toolsv1.SimulationFailed,
+					Commit:             "abc",
+					Artifacts:          []toolsv1.Artifact{{Name: "state.json", Key: "sim/1/state.json.gz"}},
+					ArtifactsCollected: true,
+					Logs:               []toolsv1.ContainerLogStatus{{Container: "simulation", Complete: false}},
+				},
+			},
+		},
+	}
+
+	// Logs are still being uploaded
+	if err := r.updateManifest(context.Background(), sim); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sim.Status.Manifest != nil {
+		t.Fatalf("wanted no manifest, got %+v", sim.Status.Manifest)
+	}
+
+	sim.Status.JobStatus[0].Logs[0] = toolsv1.ContainerLogStatus{Container: "simulation", Complete: true, Key: "sim/1/simulation.log.gz"}
+	if err := r.updateManifest(context.Background(), sim); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sim.Status.Manifest == nil || sim.Status.Manifest.Key != "default/sim/manifest.json" {
+		t.Fatalf("wanted manifest, got %+v", sim.Status.Manifest)
+	}
+
+	rc, err := store.Get(context.Background(), "default/sim/manifest.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, _ := ioutil.ReadAll(rc)
+
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(m.Seeds) != 1 || m.Seeds[0].Commit != "abc" || len(m.Seeds[0].Logs) != 1 || len(m.Seeds[0].Artifacts) != 1 {
+		t.Fatalf("unexpected manifest %+v", m)
+	}
+}
+
+func TestUpdateManifestRewritten(t *testing.T) {
+	store := newMemoryStore()
+	r := &SimulationReconciler{store: store}
+
+	sim := &toolsv1.Simulation{
+		ObjectMeta: metav1.ObjectMeta{Name: "sim", Namespace: "default"},
+		Status: toolsv1.SimulationStatus{
+			Status: toolsv1.SimulationCancelled,
+			JobStatus: []toolsv1.JobStatus{
+				{
+					Name:               "sim-1",
+					Seed:               "1",
+					Status:             toolsv1.SimulationSucceed,
+					ArtifactsCollected: true,
+				},
+				// Cancelled before it ran
+				{Name: "sim-2", Seed: "2", Status: toolsv1.SimulationCancelled},
+			},
+		},
+	}
+
+	// Cancelled seeds do not prevent the manifest from being written
+	if err := r.updateManifest(context.Background(), sim); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sim.Status.Manifest == nil {
+		t.Fatalf("wanted manifest for cancelled simulation")
+	}
+	digest := sim.Status.ManifestDigest
+
+	// Nothing changed
+	if err := r.updateManifest(context.Background(), sim); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sim.Status.ManifestDigest != digest {
+		t.Fatalf("wanted digest %q, got %q", digest, sim.Status.ManifestDigest)
+	}
+
+	// The final status changes, e.g. after a benchmark regression
+	sim.Status.Status = toolsv1.SimulationFailed
+	if err := r.updateManifest(context.Background(), sim); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sim.Status.ManifestDigest == digest {
+		t.Fatalf("wanted manifest to be written again")
+	}
+
+	rc, err := store.Get(context.Background(), "default/sim/manifest.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, _ := ioutil.ReadAll(rc)
+
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if m.Status != toolsv1.SimulationFailed || len(m.Seeds) != 2 {
+		t.Fatalf("unexpected manifest %+v", m)
+	}
+}
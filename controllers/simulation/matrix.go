@@ -0,0 +1,187 @@
+package simulation
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+)
+
+// Names of the matrix parameters, as reported in job status.
+const (
+	versionParameter   = "version"
+	blocksParameter    = "blocks"
+	blockSizeParameter = "blockSize"
+	periodParameter    = "period"
+	replicaParameter   = "replica"
+	archParameter      = "arch"
+)
+
+var invalidCellNameChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// matrixCell is a combination of the values of the simulation matrix. The
+// cell of simulations without a matrix has no name and overrides nothing.
+// Replicas of the same values, run to check for non-determinism, are
+// separate cells of the same group. So are the stages of simulations run in
+// several jobs, each stage depending on the cell of the previous one.
+type matrixCell struct {
+	Name       string
+	Parameters map[string]string
+
+	group                     string
+	version                   string
+	blocks, blockSize, period int
+	arch                      string
+
+	stage, previous   string
+	test, upgradeName string
+}
+
+// getMatrixCells returns the cells of the simulation matrix, in a stable order.
+func getMatrixCells(sim *toolsv1.Simulation) []matrixCell {
+	cells := []matrixCell{{}}
+	m := sim.Spec.Matrix
+	if m == nil {
+		m = &toolsv1.MatrixSpec{}
+	}
+
+	// Each parameter multiplies the cells by its values, named by the
+	// parameter prefix followed by the value.
+	expand := func(name, prefix string, values []string, set func(c *matrixCell, i int)) {
+		if len(values) == 0 {
+			return
+		}
+		expanded := make([]matrixCell, 0, len(cells)*len(values))
+		for _, c := range cells {
+			for i, v := range values {
+				cell := c
+				cell.Name = joinCellName(c.Name, prefix+v)
+				cell.Parameters = make(map[string]string, len(c.Parameters)+1)
+				for k, v := range c.Parameters {
+					cell.Parameters[k] = v
+				}
+				cell.Parameters[name] = v
+				set(&cell, i)
+				expanded = append(expanded, cell)
+			}
+		}
+		cells = expanded
+	}
+
+	expand(versionParameter, "", m.Versions, func(c *matrixCell, i int) { c.version = m.Versions[i] })
+	expand(blocksParameter, "b", itoa(m.Blocks), func(c *matrixCell, i int) { c.blocks = m.Blocks[i] })
+	expand(blockSizeParameter, "bs", itoa(m.BlockSizes), func(c *matrixCell, i int) { c.blockSize = m.BlockSizes[i] })
+	expand(periodParameter, "p", itoa(m.Periods), func(c *matrixCell, i int) { c.period = m.Periods[i] })
+
+	// Cells are told apart by a hash of their values, as distinct values may
+	// have the same name once sanitised, e.g. v0.45 and v0-45
+	for i := range cells {
+		if cells[i].Name != "" {
+			cells[i].Name = joinCellName(cells[i].Name, getCellHash(cells[i].Parameters))
+		}
+		cells[i].group = cells[i].Name
+	}
+
+	// The first replica keeps the name of its cell, so that adding replicas
+	// does not rename the cells run so far
+	if d := sim.Spec.Config.Determinism; d != nil && d.Replicas > 1 {
+		replicated := make([]matrixCell, 0, len(cells)*d.Replicas)
+		for _, c := range cells {
+			for i := 0; i < d.Replicas; i++ {
+				cell := c
+				if i > 0 {
+					cell.Name = joinCellName(c.Name, "r"+strconv.Itoa(i))
+				}
+				cell.Parameters = make(map[string]string, len(c.Parameters)+2)
+				for k, v := range c.Parameters {
+					cell.Parameters[k] = v
+				}
+				cell.Parameters[replicaParameter] = strconv.Itoa(i)
+				if len(d.Architectures) > 0 {
+					cell.arch = d.Architectures[i%len(d.Architectures)]
+					cell.Parameters[archParameter] = cell.arch
+				}
+				replicated = append(replicated, cell)
+			}
+		}
+		cells = replicated
+	}
+
+	if u := sim.Spec.Upgrade; u != nil {
+		cells = getUpgradeCells(cells, u)
+	}
+
+	return cells
+}
+
+func itoa(values []int) []string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = strconv.Itoa(v)
+	}
+	return s
+}
+
+// joinCellName appends the value to the name of a cell, keeping only the
+// characters allowed in job names.
+func joinCellName(name, value string) string {
+	value = strings.Trim(invalidCellNameChars.ReplaceAllString(strings.ToLower(value), "-"), "-")
+	if name == "" {
+		return value
+	}
+	return name + "-" + value
+}
+
+// getCellHash returns a short hash of the values of a cell.
+func getCellHash(parameters map[string]string) string {
+	keys := make([]string, 0, len(parameters))
+	for k := range parameters {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	hash := sha256.New()
+	for _, k := range keys {
+		_, _ = hash.Write([]byte(k + "=" + parameters[k] + "\n"))
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:cellHashLength]
+}
+
+// hasMatrixCell returns whether the cell with the given name is part of the matrix.
+func hasMatrixCell(sim *toolsv1.Simulation, name string) bool {
+	for _, c := range getMatrixCells(sim) {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// apply returns a copy of the simulation with the values of the cell set in spec.
+func (c matrixCell) apply(sim *toolsv1.Simulation) *toolsv1.Simulation {
+	sim = sim.DeepCopy()
+	if c.version != "" {
+		sim.Spec.Target.Version = c.version
+	}
+	if c.blocks != 0 {
+		sim.Spec.Config.Blocks = c.blocks
+	}
+	if c.blockSize != 0 {
+		sim.Spec.Config.BlockSize = c.blockSize
+	}
+	if c.period != 0 {
+		sim.Spec.Config.Period = c.period
+	}
+	if c.test != "" {
+		sim.Spec.Config.Test = c.test
+	}
+	// Stages continue from the state of the previous stage instead
+	if c.previous != "" {
+		sim.Spec.Config.Genesis = nil
+	}
+	return sim
+}
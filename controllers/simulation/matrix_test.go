@@ -0,0 +1,87 @@
+package simulation
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+)
+
+func TestGetMatrixCells(t *testing.T) {
+	sim := &toolsv1.Simulation{ObjectMeta: metav1.ObjectMeta{Name: "sim", Namespace: "default"}}
+	sim.Spec.Target.Version = "master"
+	sim.Spec.Config.BlockSize = 200
+
+	if cells := getMatrixCells(sim); len(cells) != 1 || cells[0].Name != "" {
+		t.Fatalf("wanted a single unnamed cell without matrix, got %+v", cells)
+	}
+	if name := getJobName(sim, "", "1"); name != "sim-1" {
+		t.Fatalf("wanted job name to be kept without matrix, got %s", name)
+	}
+
+	sim.Spec.Matrix = &toolsv1.MatrixSpec{
+		Versions:   []string{"v0.44.0", "release/v0.45.x"},
+		BlockSizes: []int{100, 200, 400},
+	}
+	cells := getMatrixCells(sim)
+
+	var names []string
+	for _, c := range cells {
+		names = append(names, c.Name)
+	}
+	want := []string{
+		"v0-44-0-bs100-fd144f", "v0-44-0-bs200-3402e5", "v0-44-0-bs400-eafff4",
+		"release-v0-45-x-bs100-e28272", "release-v0-45-x-bs200-d05838", "release-v0-45-x-bs400-b1eea6",
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("unexpected cells %v", names)
+	}
+
+	cell := cells[5]
+	if !reflect.DeepEqual(cell.Parameters, map[string]string{versionParameter: "release/v0.45.x", blockSizeParameter: "400"}) {
+		t.Fatalf("unexpected parameters %v", cell.Parameters)
+	}
+
+	job, err := getJobSpec(sim, cell, "7", defaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Name != "sim-release-v0-45-x-bs400-b1eea6-7" || job.Labels[MatrixCellLabelKey] != cell.Name {
+		t.Fatalf("unexpected job %s with labels %v", job.Name, job.Labels)
+	}
+	cmd := job.Spec.Template.Spec.Containers[0].Args[2]
+	if !strings.Contains(cmd, "-BlockSize=400") {
+		t.Fatalf("wanted the cell block size to be run, got %s", cmd)
+	}
+	if clone := job.Spec.Template.Spec.InitContainers[0].Command[2]; !strings.Contains(clone, "'release/v0.45.x'") {
+		t.Fatalf("wanted the cell version to be cloned, got %s", clone)
+	}
+	if sim.Spec.Config.BlockSize != 200 {
+		t.Fatalf("wanted simulation spec to be left untouched")
+	}
+
+	if p := getArtifactsPrefix(sim, cell.Name, "7"); p != "default/sim/release-v0-45-x-bs400-b1eea6/7" {
+		t.Fatalf("unexpected artifacts prefix %s", p)
+	}
+	if !hasMatrixCell(sim, cell.Name) || hasMatrixCell(sim, "") {
+		t.Fatalf("unexpected matrix cells")
+	}
+
+	// Values named alike once sanitised are told apart
+	sim.Spec.Matrix = &toolsv1.MatrixSpec{Versions: []string{"v0.45", "v0-45"}}
+	if cells := getMatrixCells(sim); cells[0].Name == cells[1].Name {
+		t.Fatalf("wanted distinct cells, got %s", cells[0].Name)
+	}
+	if err := validateSimulation(sim, defaultOptions()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Duplicate values are rejected
+	sim.Spec.Matrix = &toolsv1.MatrixSpec{Versions: []string{"v0.45", "v0.45"}}
+	if err := validateSimulation(sim, defaultOptions()); err == nil {
+		t.Fatalf("wanted duplicate cells to be rejected")
+	}
+}
@@ -0,0 +1,177 @@
+package simulation
+
+import (
+	"fmt"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+)
+
+// Reasons for which simulations fail, interpreted from their output.
+const (
+	nondeterministicReason     = "Nondeterministic"
+	importExportMismatchReason = "ImportExportMismatch"
+	invariantBrokenReason      = "InvariantBroken"
+	testTimeoutReason          = "TestTimeout"
+	panicReason                = "Panic"
+)
+
+// Results reported by the simulation container as key=value lines of its
+// termination message.
+const (
+	reasonResult    = "reason"
+	stateHashResult = "stateHash"
+)
+
+// simulationMode describes how the simulations of a mode are run.
+type simulationMode struct {
+	// The test run unless one is set in spec.
+	test      string
+	benchmark bool
+	// Whether the test runs the seed given, rather than random ones.
+	seeded bool
+	// Whether the test can export the simulation state and params.
+	exports bool
+	// Failures recognised in the output of the test, in order.
+	failures []failurePattern
+}
+
+// failurePattern associates the output of failed simulations with a reason.
+type failurePattern struct {
+	pattern string
+	reason  string
+}
+
+// commonFailures are recognised in the output of every mode.
+var commonFailures = []failurePattern{
+	{pattern: "panic: test timed out", reason: testTimeoutReason},
+	{pattern: "invariant broken", reason: invariantBrokenReason},
+	{pattern: "panic:", reason: panicReason},
+}
+
+var simulationModes = map[toolsv1.SimulationMode]simulationMode{
+	toolsv1.FullAppMode: {
+		test:     DefaultTest,
+		seeded:   true,
+		exports:  true,
+		failures: commonFailures,
+	},
+	toolsv1.ImportExportMode: {
+		test:    "TestAppImportExport",
+		seeded:  true,
+		exports: true,
+		failures: append([]failurePattern{
+			{pattern: "different key/value pairs", reason: importExportMismatchReason},
+		}, commonFailures...),
+	},
+	toolsv1.AfterImportMode: {
+		test:     "TestAppSimulationAfterImport",
+		seeded:   true,
+		exports:  true,
+		failures: commonFailures,
+	},
+	toolsv1.NondeterminismMode: {
+		test: "TestAppStateDeterminism",
+		// The test only draws random seeds when none is given
+		seeded: true,
+		failures: append([]failurePattern{
+			{pattern: "non-determinism in seed", reason: nondeterministicReason},
+		}, commonFailures...),
+	},
+	toolsv1.BenchmarkMode: {
+		test:      "BenchmarkFullAppSimulation",
+		benchmark: true,
+		seeded:    true,
+		exports:   true,
+		failures:  commonFailures,
+	},
+}
+
+// getSimulationMode returns how the simulation is run, by default according
+// to whether it is a benchmark.
+func getSimulationMode(sim *toolsv1.Simulation) simulationMode {
+	if mode, ok := simulationModes[sim.Spec.Config.Mode]; ok {
+		return mode
+	}
+	if sim.Spec.Config.Benchmark {
+		return simulationModes[toolsv1.BenchmarkMode]
+	}
+	return simulationModes[toolsv1.FullAppMode]
+}
+
+// getSimulationTest returns the test run by the simulation, by default the
+// test of its mode, so that it follows changes of mode.
+func getSimulationTest(sim *toolsv1.Simulation) string {
+	if sim.Spec.Config.Test != "" {
+		return sim.Spec.Config.Test
+	}
+	return getSimulationMode(sim).test
+}
+
+// getOutputCmd returns the command printing the output of the simulation and
+// keeping in outputPath only the lines its result is interpreted from, so
+// that the output is not stored twice on disk.
+func getOutputCmd(mode simulationMode) string {
+	var conditions []string
+	for _, f := range mode.failures {
+		conditions = append(conditions, fmt.Sprintf("index($0, %q)", f.pattern))
+	}
+	if mode.benchmark {
+		conditions = append(conditions, "/^Benchmark/")
+	}
+	program := fmt.Sprintf(`BEGIN { printf "" > %q } { print; fflush() } %s { print > %q }`,
+		outputPath, strings.Join(conditions, " || "), outputPath)
+	return "awk " + shellQuote(program)
+}
+
+// getResultCmd returns the command reporting why the simulation failed,
+// according to its output, in the termination message of the simulation
+// container. It expects the exit code of the simulation in $rc.
+func getResultCmd(mode simulationMode) string {
+	cmd := "if [ $rc -eq 0 ]; then :"
+	for _, f := range mode.failures {
+		cmd += fmt.Sprintf("; elif grep -qF -- %s %s; then echo %s=%s > /dev/termination-log",
+			shellQuote(f.pattern), outputPath, reasonResult, f.reason)
+	}
+	return cmd + "; fi; "
+}
+
+// updateJobResult records the results reported by the simulation container
+// of the job once it terminated.
+func updateJobResult(sim *toolsv1.Simulation, job *batchv1.Job, pod *corev1.Pod) {
+	status := getJobStatus(sim, job.Name)
+	if status == nil || pod == nil {
+		return
+	}
+
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.Name != simulationContainerName || cs.State.Terminated == nil {
+			continue
+		}
+		results := parseResults(cs.State.Terminated.Message)
+		if cs.State.Terminated.ExitCode != 0 && status.Reason == "" {
+			status.Reason = results[reasonResult]
+		}
+		if status.StateHash == "" {
+			status.StateHash = results[stateHashResult]
+		}
+		if status.Benchmarks == nil {
+			status.Benchmarks = parseBenchmarks(cs.State.Terminated.Message)
+		}
+	}
+}
+
+// parseResults parses the key=value lines of a termination message.
+func parseResults(message string) map[string]string {
+	results := make(map[string]string)
+	for _, line := range strings.Split(message, "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), "=", 2)
+		if len(parts) == 2 {
+			results[parts[0]] = parts[1]
+		}
+	}
+	return results
+}
@@ -0,0 +1,115 @@
+package simulation
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+)
+
+func TestSimulationModes(t *testing.T) {
+	r := &SimulationReconciler{}
+	sim := &toolsv1.Simulation{ObjectMeta: metav1.ObjectMeta{Name: "sim"}}
+	sim.Spec.Config.Benchmark = true
+	r.setSimulationDefaults(sim)
+	if sim.Spec.Config.Mode != toolsv1.BenchmarkMode || getSimulationTest(sim) != "BenchmarkFullAppSimulation" {
+		t.Fatalf("wanted benchmark mode, got %s %s", sim.Spec.Config.Mode, getSimulationTest(sim))
+	}
+
+	sim = &toolsv1.Simulation{ObjectMeta: metav1.ObjectMeta{Name: "sim"}}
+	sim.Spec.Config.Mode = toolsv1.NondeterminismMode
+	r.setSimulationDefaults(sim)
+	if getSimulationTest(sim) != "TestAppStateDeterminism" {
+		t.Fatalf("wanted nondeterminism test, got %s", getSimulationTest(sim))
+	}
+
+	opts := defaultOptions()
+	opts.LogBackupEnabled = true
+	job, err := getJobSpec(sim, matrixCell{}, "7", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := job.Spec.Template.Spec.Containers[0].Args[2]
+	if !strings.Contains(cmd, "-Seed=7") {
+		t.Fatalf("wanted each job to run its seed, got %s", cmd)
+	}
+	if strings.Contains(cmd, "-ExportStatePath") {
+		t.Fatalf("wanted no -ExportStatePath flag, got %s", cmd)
+	}
+	if !strings.Contains(cmd, "-run=TestAppStateDeterminism") || !strings.HasSuffix(cmd, "exit $rc") {
+		t.Fatalf("unexpected command %s", cmd)
+	}
+
+	// The test follows changes of mode
+	sim.Spec.Config.Mode = toolsv1.ImportExportMode
+	r.setSimulationDefaults(sim)
+	job, err = getJobSpec(sim, matrixCell{}, "7", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd = job.Spec.Template.Spec.Containers[0].Args[2]
+	if !strings.Contains(cmd, "-run=TestAppImportExport") || !strings.Contains(cmd, "-Seed=7") || !strings.Contains(cmd, "-ExportStatePath") {
+		t.Fatalf("unexpected command %s", cmd)
+	}
+}
+
+func TestGetResultCmd(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not available")
+	}
+
+	dir, err := ioutil.TempDir("", "output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	mode := simulationModes[toolsv1.NondeterminismMode]
+	for _, c := range []struct {
+		rc, output, reason string
+	}{
+		{"0", "ok", ""},
+		{"1", "non-determinism in seed 1: 2/3, attempt: 1/5", nondeterministicReason},
+		{"1", "panic: invariant broken: bank", invariantBrokenReason},
+		{"1", "FAIL", ""},
+	} {
+		// Run the command against a local output, reporting to stdout
+		output := filepath.Join(dir, "output.log")
+		script := strings.NewReplacer(outputPath, output, "/dev/termination-log", "/dev/stdout").
+			Replace("printf '%s\\n' " + shellQuote(c.output) + " | " + getOutputCmd(mode) + " > /dev/null; rc=" + c.rc + "; " + getResultCmd(mode))
+		out, err := exec.Command("bash", "-c", script).Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reason := parseResults(string(out))[reasonResult]; reason != c.reason {
+			t.Fatalf("wanted reason %q for %q, got %q", c.reason, c.output, reason)
+		}
+	}
+}
+
+func TestUpdateJobResult(t *testing.T) {
+	sim := &toolsv1.Simulation{ObjectMeta: metav1.ObjectMeta{Name: "sim"}}
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: getJobName(sim, "", "1")}}
+	setJobStatus(sim, matrixCell{}, "1", toolsv1.SimulationFailed)
+
+	pod := &corev1.Pod{Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+		Name: simulationContainerName,
+		State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+			ExitCode: 1,
+			Message:  reasonResult + "=" + nondeterministicReason + "\n" + stateHashResult + "=abc\n",
+		}},
+	}}}}
+	updateJobResult(sim, job, pod)
+	status := getJobStatus(sim, job.Name)
+	if status.Reason != nondeterministicReason || status.StateHash != "abc" {
+		t.Fatalf("unexpected results %q %q", status.Reason, status.StateHash)
+	}
+}
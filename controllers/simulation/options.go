@@ -1,25 +1,76 @@
 package simulation
 
+import (
+	"time"
+
+	"github.com/allinbits/runsim-operator/internal/s3"
+)
+
 const (
 	DefaultMinioEndpoint  = "s3.amazonaws.com"
 	DefaultLogsBucketName = "simulation-logs"
+	DefaultToolsImage     = "runsim-operator:latest"
+	DefaultArtifactStore  = S3ArtifactStore
+	DefaultArtifactsDir   = "/artifacts"
 )
 
 func defaultOptions() *Options {
 	return &Options{
 		LogBackupEnabled: false,
+		ArtifactStore:    DefaultArtifactStore,
 		MinioEndpoint:    DefaultMinioEndpoint,
 		LogsBucketName:   DefaultLogsBucketName,
+		ArtifactsDir:     DefaultArtifactsDir,
+		ToolsImage:       DefaultToolsImage,
 	}
 }
 
 type Options struct {
 	LogBackupEnabled  bool
+	ArtifactStore     string
 	MinioEndpoint     string
 	LogsBucketName    string
+	S3Region          string
+	S3Insecure        bool
+	S3PathStyle       bool
 	S3AccessKeyId     string
 	S3SecretAccessKey string
+	ArtifactsDir      string
+	ArtifactsPVC      string
 	ImagePullSecret   string
+	ToolsImage        string
+
+	// OrphanedArtifactsRetention is the time after which the artifacts of
+	// simulations that no longer exist are deleted. Zero keeps them forever.
+	OrphanedArtifactsRetention time.Duration
+}
+
+func (opts *Options) s3Config() s3.Config {
+	return s3.Config{
+		Endpoint:        opts.MinioEndpoint,
+		Bucket:          opts.LogsBucketName,
+		Region:          opts.S3Region,
+		AccessKeyId:     opts.S3AccessKeyId,
+		SecretAccessKey: opts.S3SecretAccessKey,
+		Insecure:        opts.S3Insecure,
+		PathStyle:       opts.S3PathStyle,
+	}
+}
+
+// podArtifactsEnabled returns whether simulation pods can upload artifacts
+// to the configured store themselves.
+func (opts *Options) podArtifactsEnabled() bool {
+	if !opts.LogBackupEnabled {
+		return false
+	}
+	switch opts.ArtifactStore {
+	case S3ArtifactStore:
+		return true
+	case FilesystemArtifactStore:
+		return opts.ArtifactsPVC != ""
+	default:
+		return false
+	}
 }
 
 type Option func(*Options)
@@ -30,6 +81,12 @@ func EnableLogBackups(v bool) Option {
 	}
 }
 
+func WithArtifactStore(s string) Option {
+	return func(opts *Options) {
+		opts.ArtifactStore = s
+	}
+}
+
 func MinioEndpoint(s string) Option {
 	return func(opts *Options) {
 		opts.MinioEndpoint = s
@@ -42,6 +99,24 @@ func LogsBucketName(s string) Option {
 	}
 }
 
+func S3Region(s string) Option {
+	return func(opts *Options) {
+		opts.S3Region = s
+	}
+}
+
+func S3Insecure(v bool) Option {
+	return func(opts *Options) {
+		opts.S3Insecure = v
+	}
+}
+
+func S3PathStyle(v bool) Option {
+	return func(opts *Options) {
+		opts.S3PathStyle = v
+	}
+}
+
 func S3AccessKeyId(s string) Option {
 	return func(opts *Options) {
 		opts.S3AccessKeyId = s
@@ -54,8 +129,32 @@ func S3SecretAccessKey(s string) Option {
 	}
 }
 
+func ArtifactsDir(s string) Option {
+	return func(opts *Options) {
+		opts.ArtifactsDir = s
+	}
+}
+
+func ArtifactsPVC(s string) Option {
+	return func(opts *Options) {
+		opts.ArtifactsPVC = s
+	}
+}
+
 func WithImagePullSecret(s string) Option {
 	return func(opts *Options) {
 		opts.ImagePullSecret = s
 	}
 }
+
+func WithToolsImage(s string) Option {
+	return func(opts *Options) {
+		opts.ToolsImage = s
+	}
+}
+
+func WithOrphanedArtifactsRetention(d time.Duration) Option {
+	return func(opts *Options) {
+		opts.OrphanedArtifactsRetention = d
+	}
+}
@@ -0,0 +1,112 @@
+package simulation
+
+import (
+	"fmt"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+)
+
+// simulationEndResult holds when the simulation ended, before its artifacts
+// are uploaded by the simulation container.
+const simulationEndResult = "simulationEnd"
+
+// getSimulationEndCmd returns the command reporting when the simulation ended
+// in the termination message of the simulation container.
+func getSimulationEndCmd() string {
+	return fmt.Sprintf("echo %s=$(%s) >> /dev/termination-log; ", simulationEndResult, dateCmd)
+}
+
+// updateJobPhases records the phases the job went through, timed after the
+// containers of its pod. Phases are recorded once, so that they are kept
+// once the pod is gone.
+func updateJobPhases(sim *toolsv1.Simulation, job *batchv1.Job, pod *corev1.Pod, logBackup bool) {
+	status := getJobStatus(sim, job.Name)
+	if status == nil {
+		return
+	}
+
+	record := func(phase toolsv1.JobPhase, t metav1.Time) {
+		if t.IsZero() {
+			return
+		}
+		for _, p := range status.Phases {
+			if p.Phase == phase {
+				return
+			}
+		}
+		status.Phases = append(status.Phases, toolsv1.JobPhaseStatus{Phase: phase, StartTime: t})
+		status.Phase = phase
+	}
+
+	record(toolsv1.JobScheduling, job.CreationTimestamp)
+
+	var finishedAt metav1.Time
+	if pod != nil {
+		for _, cs := range pod.Status.InitContainerStatuses {
+			if cs.Name == cloneContainerName {
+				record(toolsv1.JobCloning, getContainerStartTime(cs))
+			} else {
+				record(toolsv1.JobDownloadingDeps, getContainerStartTime(cs))
+			}
+		}
+		for _, cs := range pod.Status.ContainerStatuses {
+			if cs.Name != simulationContainerName {
+				continue
+			}
+			record(toolsv1.JobSimulating, getContainerStartTime(cs))
+			if t := cs.State.Terminated; t != nil {
+				if end, err := time.Parse(time.RFC3339, parseResults(t.Message)[simulationEndResult]); err == nil {
+					record(toolsv1.JobUploading, metav1.NewTime(end))
+				}
+				finishedAt = t.FinishedAt
+			}
+		}
+	}
+
+	if job.Status.Succeeded == 0 && job.Status.Failed == 0 {
+		return
+	}
+	if finishedAt.IsZero() {
+		finishedAt = getJobCompletionTime(job)
+	}
+
+	// Logs are backed up by the controller once the job finished
+	if logBackup {
+		record(toolsv1.JobUploading, finishedAt)
+		if !status.LogsBackedUp {
+			return
+		}
+		finishedAt = metav1.Now()
+	}
+	record(toolsv1.JobFinished, finishedAt)
+}
+
+// getContainerStartTime returns when the container started, if it did.
+func getContainerStartTime(cs corev1.ContainerStatus) metav1.Time {
+	switch {
+	case cs.State.Running != nil:
+		return cs.State.Running.StartedAt
+	case cs.State.Terminated != nil:
+		return cs.State.Terminated.StartedAt
+	default:
+		return metav1.Time{}
+	}
+}
+
+// getJobCompletionTime returns when the finished job completed or failed.
+func getJobCompletionTime(job *batchv1.Job) metav1.Time {
+	if job.Status.CompletionTime != nil {
+		return *job.Status.CompletionTime
+	}
+	for _, c := range job.Status.Conditions {
+		if c.Type == batchv1.JobFailed && c.Status == corev1.ConditionTrue {
+			return c.LastTransitionTime
+		}
+	}
+	return metav1.Now()
+}
@@ -0,0 +1,77 @@
+package simulation
+
+import (
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+)
+
+func TestUpdateJobPhases(t *testing.T) {
+	sim := &toolsv1.Simulation{ObjectMeta: metav1.ObjectMeta{Name: "sim"}}
+	setJobStatus(sim, matrixCell{}, "1", toolsv1.SimulationRunning)
+	status := getJobStatus(sim, getJobName(sim, "", "1"))
+
+	at := func(minutes int) metav1.Time {
+		return metav1.NewTime(time.Date(2020, 1, 1, 0, minutes, 0, 0, time.UTC))
+	}
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: status.Name, CreationTimestamp: at(0)}}
+	pod := &corev1.Pod{}
+
+	phases := func() []toolsv1.JobPhase {
+		var p []toolsv1.JobPhase
+		for _, s := range status.Phases {
+			p = append(p, s.Phase)
+		}
+		return p
+	}
+
+	// The pod is not scheduled yet
+	updateJobPhases(sim, job, pod, true)
+	if status.Phase != toolsv1.JobScheduling {
+		t.Fatalf("wanted scheduling, got %v", phases())
+	}
+
+	// Modules are being downloaded
+	pod.Status.InitContainerStatuses = []corev1.ContainerStatus{
+		{Name: cloneContainerName, State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{StartedAt: at(1), FinishedAt: at(2)}}},
+		{Name: "go-mod", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: at(2)}}},
+	}
+	updateJobPhases(sim, job, pod, true)
+	if status.Phase != toolsv1.JobDownloadingDeps || len(status.Phases) != 3 || status.Phases[1].StartTime.Time != at(1).Time {
+		t.Fatalf("wanted downloading deps, got %+v", status.Phases)
+	}
+
+	// The simulation ended and its artifacts were uploaded
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+		{Name: simulationContainerName, State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+			StartedAt:  at(5),
+			FinishedAt: at(40),
+			Message:    simulationEndResult + "=2020-01-01T00:30:00Z\n",
+		}}},
+	}
+	job.Status.Succeeded = 1
+	updateJobPhases(sim, job, pod, true)
+	if status.Phase != toolsv1.JobUploading || status.Phases[4].StartTime.Time != at(30).Time {
+		t.Fatalf("wanted uploading since the simulation ended, got %+v", status.Phases)
+	}
+
+	// Logs were backed up
+	status.LogsBackedUp = true
+	updateJobPhases(sim, job, pod, true)
+	want := []toolsv1.JobPhase{toolsv1.JobScheduling, toolsv1.JobCloning, toolsv1.JobDownloadingDeps,
+		toolsv1.JobSimulating, toolsv1.JobUploading, toolsv1.JobFinished}
+	if got := phases(); len(got) != len(want) || status.Phase != toolsv1.JobFinished {
+		t.Fatalf("wanted %v, got %v", want, got)
+	}
+
+	// Phases are kept once the pod is gone
+	updateJobPhases(sim, job, nil, true)
+	if len(status.Phases) != len(want) {
+		t.Fatalf("wanted phases to be kept, got %+v", status.Phases)
+	}
+}
@@ -0,0 +1,217 @@
+package simulation
+
+import (
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+)
+
+const (
+	// simulateStage is the pipeline stage running the simulation.
+	simulateStage = "simulate"
+
+	// stageContainerPrefix prefixes the containers of custom stages, so
+	// that they do not conflict with the containers preparing the job.
+	stageContainerPrefix = "stage-"
+
+	defaultStageImage = "golang"
+
+	// Environment of custom stages.
+	seedEnv             = "SEED"
+	artifactsPrefixEnv  = "ARTIFACTS_PREFIX"
+	skippedStageMessage = "skipped"
+)
+
+// getPipeline returns the stages run by the jobs of the simulation, in order.
+func getPipeline(sim *toolsv1.Simulation) []toolsv1.PipelineStage {
+	for _, s := range sim.Spec.Pipeline {
+		if s.Name == simulateStage {
+			return sim.Spec.Pipeline
+		}
+	}
+	return append([]toolsv1.PipelineStage{{Name: simulateStage}}, sim.Spec.Pipeline...)
+}
+
+func getStageContainerName(stage string) string {
+	if stage == simulateStage {
+		return simulationContainerName
+	}
+	return stageContainerPrefix + stage
+}
+
+// applyPipeline replaces the simulation container of the job by a container
+// per stage. Containers run concurrently, so each stage waits for the
+// previous one to report its exit code in the workspace before it starts,
+// and is skipped if it failed.
+func applyPipeline(job *batchv1.Job, sim *toolsv1.Simulation, cell matrixCell, seed string, opts *Options) {
+	simContainer := job.Spec.Template.Spec.Containers[0]
+
+	var containers []corev1.Container
+	previous := ""
+	for _, stage := range getPipeline(sim) {
+		container := simContainer
+		if stage.Name != simulateStage {
+			image := stage.Image
+			if image == "" {
+				image = defaultStageImage
+			}
+			container = corev1.Container{
+				Name:         getStageContainerName(stage.Name),
+				Image:        image,
+				Command:      stage.Command,
+				WorkingDir:   "/workspace",
+				Env:          []corev1.EnvVar{{Name: seedEnv, Value: seed}},
+				EnvFrom:      simContainer.EnvFrom,
+				VolumeMounts: simContainer.VolumeMounts,
+				Resources:    stage.Resources,
+			}
+			if opts.podArtifactsEnabled() {
+				container.Env = append(container.Env, corev1.EnvVar{
+					Name:  artifactsPrefixEnv,
+					Value: getArtifactsPrefix(sim, cell.Name, seed),
+				})
+			}
+		}
+
+		// Run the command of the stage once the previous stage is done
+		argv := append(append([]string{}, container.Command...), container.Args...)
+		container.Command = []string{"sh", "-c", getStageCmd(stage.Name, previous), stage.Name}
+		container.Args = argv
+
+		containers = append(containers, container)
+		previous = stage.Name
+	}
+	shareStageRequests(containers)
+	job.Spec.Template.Spec.Containers = containers
+}
+
+// shareStageRequests makes the pod request the resources of its most
+// demanding stage rather than of all its stages, as they run one at a time:
+// each resource is requested by the container requesting the most of it.
+func shareStageRequests(containers []corev1.Container) {
+	requests := make([]corev1.ResourceList, len(containers))
+	max := make(map[corev1.ResourceName]int)
+	for i, c := range containers {
+		// Requests default to the limits
+		requests[i] = make(corev1.ResourceList)
+		for name, q := range c.Resources.Limits {
+			requests[i][name] = q
+		}
+		for name, q := range c.Resources.Requests {
+			requests[i][name] = q
+		}
+		for name, q := range requests[i] {
+			if j, ok := max[name]; !ok || q.Cmp(requests[j][name]) > 0 {
+				max[name] = i
+			}
+		}
+	}
+
+	for i := range containers {
+		if len(requests[i]) == 0 {
+			continue
+		}
+		containers[i].Resources = *containers[i].Resources.DeepCopy()
+		containers[i].Resources.Requests = requests[i]
+		for name := range requests[i] {
+			if max[name] != i {
+				requests[i][name] = *resource.NewQuantity(0, resource.DecimalSI)
+			}
+		}
+	}
+}
+
+// getStageCmd returns the script running the command given as arguments
+// once the previous stage succeeded, and reporting its exit code. The stage
+// reports a failure if it is terminated before its command exits, so that the
+// next stages do not wait for it.
+func getStageCmd(stage, previous string) string {
+	cmd := fmt.Sprintf(`mkdir -p %[1]s; rc=1; trap 'echo $rc > %[1]s/%[2]s' EXIT; trap exit TERM INT; `, stagesDir, stage)
+	if previous != "" {
+		cmd += fmt.Sprintf(`while [ ! -f %[1]s/%[2]s ]; do sleep 1; done; `+
+			`if [ "$(cat %[1]s/%[2]s)" != 0 ]; then rc=%[3]s; echo %[4]s=%[5]s > /dev/termination-log; exit 0; fi; `,
+			stagesDir, previous, skippedStageMessage, reasonResult, previousStageFailedReason)
+	}
+	// The command runs in the background for the signals to be forwarded to it
+	return cmd + `"$@" & pid=$!; trap 'kill $pid; exit' TERM INT; wait $pid; rc=$?; exit $rc`
+}
+
+// getStuckStage returns the stage of the pipeline run by the pod which failed
+// without reporting it, such as when it is killed, while the next stages wait
+// for it, if any.
+func getStuckStage(sim *toolsv1.Simulation, pod *corev1.Pod) string {
+	if pod == nil || len(sim.Spec.Pipeline) == 0 {
+		return ""
+	}
+	terminated := make(map[string]*corev1.ContainerStateTerminated)
+	for _, cs := range pod.Status.ContainerStatuses {
+		terminated[cs.Name] = cs.State.Terminated
+	}
+
+	failed := ""
+	for _, stage := range getPipeline(sim) {
+		t, ok := terminated[getStageContainerName(stage.Name)]
+		switch {
+		case failed != "" && ok && t == nil:
+			return failed
+		case t != nil && t.ExitCode != 0 && failed == "":
+			failed = stage.Name
+		}
+	}
+	return ""
+}
+
+// updateJobStages records the status of each pipeline stage run by the job.
+func updateJobStages(sim *toolsv1.Simulation, job *batchv1.Job, pod *corev1.Pod) {
+	status := getJobStatus(sim, job.Name)
+	if status == nil || len(sim.Spec.Pipeline) == 0 {
+		return
+	}
+
+	stages := make([]toolsv1.StageStatus, 0, len(sim.Spec.Pipeline)+1)
+	for _, stage := range getPipeline(sim) {
+		s := toolsv1.StageStatus{Name: stage.Name, Status: toolsv1.SimulationPending}
+		for _, previous := range status.PipelineStages {
+			if previous.Name == stage.Name {
+				s = previous
+			}
+		}
+		if pod != nil {
+			updateStageStatus(&s, pod)
+		}
+		stages = append(stages, s)
+	}
+	status.PipelineStages = stages
+}
+
+// updateStageStatus updates the status of the stage from its container.
+func updateStageStatus(s *toolsv1.StageStatus, pod *corev1.Pod) {
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.Name != getStageContainerName(s.Name) {
+			continue
+		}
+		t := cs.State.Terminated
+		switch {
+		case t == nil && cs.State.Running != nil:
+			s.Status = toolsv1.SimulationRunning
+		case t == nil:
+			s.Status = toolsv1.SimulationPending
+		case t.ExitCode == 0 && parseResults(t.Message)[reasonResult] == previousStageFailedReason:
+			s.Status = toolsv1.SimulationSkipped
+			s.Reason = previousStageFailedReason
+		case t.ExitCode == 0:
+			s.Status = toolsv1.SimulationSucceed
+		default:
+			s.Status = toolsv1.SimulationFailed
+			s.Reason = t.Reason
+		}
+		if t != nil {
+			exitCode := t.ExitCode
+			s.ExitCode = &exitCode
+		}
+	}
+}
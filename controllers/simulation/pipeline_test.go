@@ -0,0 +1,211 @@
+package simulation
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+)
+
+func TestPipeline(t *testing.T) {
+	sim := &toolsv1.Simulation{ObjectMeta: metav1.ObjectMeta{Name: "sim"}}
+	sim.Spec.Pipeline = []toolsv1.PipelineStage{
+		{Name: "build", Command: []string{"go", "build", "./..."}},
+		{Name: simulateStage},
+		{Name: "verify", Image: "alpine", Command: []string{"sh", "-c", "test -f .tmp/state.json"}},
+	}
+
+	job, err := getJobSpec(sim, matrixCell{}, "7", defaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, c := range job.Spec.Template.Spec.Containers {
+		names = append(names, c.Name)
+	}
+	if strings.Join(names, ",") != "stage-build,simulation,stage-verify" {
+		t.Fatalf("unexpected containers %v", names)
+	}
+	verify := job.Spec.Template.Spec.Containers[2]
+	if verify.Image != "alpine" || verify.Args[0] != "sh" || !strings.Contains(verify.Command[2], stagesDir+"/simulate") {
+		t.Fatalf("unexpected verify container %+v", verify)
+	}
+	if simulate := job.Spec.Template.Spec.Containers[1]; simulate.Args[0] != "bash" || !strings.Contains(simulate.Args[2], "-Seed=7") {
+		t.Fatalf("unexpected simulation container %+v", simulate)
+	}
+
+	// The simulation runs first when it is not listed
+	sim.Spec.Pipeline = sim.Spec.Pipeline[2:]
+	if stages := getPipeline(sim); len(stages) != 2 || stages[0].Name != simulateStage {
+		t.Fatalf("unexpected stages %+v", stages)
+	}
+}
+
+func TestGetStageCmd(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+	dir, err := ioutil.TempDir("", "stages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	run := func(stage, previous string, argv ...string) (string, error) {
+		script := strings.NewReplacer(stagesDir, dir, "/dev/termination-log", "/dev/stdout").
+			Replace(getStageCmd(stage, previous))
+		out, err := exec.Command("sh", append([]string{"-c", script, stage}, argv...)...).Output()
+		return string(out), err
+	}
+
+	if _, err := run("build", "", "false"); err == nil {
+		t.Fatalf("wanted failed stage to fail")
+	}
+	out, err := run("simulate", "build", "true")
+	if err != nil || parseResults(out)[reasonResult] != previousStageFailedReason {
+		t.Fatalf("wanted stage to be skipped, got %q %v", out, err)
+	}
+	out, err = run("verify", "simulate", "true")
+	if err != nil || parseResults(out)[reasonResult] != previousStageFailedReason {
+		t.Fatalf("wanted skipped stages to skip the next ones, got %q %v", out, err)
+	}
+
+	if _, err := run("build", "", "true"); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := run("simulate", "build", "echo", "ran"); err != nil || strings.TrimSpace(out) != "ran" {
+		t.Fatalf("wanted stage to run, got %q %v", out, err)
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(dir, "simulate")); err != nil || strings.TrimSpace(string(b)) != "0" {
+		t.Fatalf("wanted exit code to be reported, got %q %v", b, err)
+	}
+
+	// Stages terminated before their command exits report a failure
+	if _, err := run("build", "", "sh", "-c", "kill -TERM $PPID; sleep 5"); err == nil {
+		t.Fatalf("wanted terminated stage to fail")
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(dir, "build")); err != nil || strings.TrimSpace(string(b)) == "0" {
+		t.Fatalf("wanted failure to be reported, got %q %v", b, err)
+	}
+	out, err = run("simulate", "build", "true")
+	if err != nil || parseResults(out)[reasonResult] != previousStageFailedReason {
+		t.Fatalf("wanted stage to be skipped, got %q %v", out, err)
+	}
+}
+
+func TestGetStuckStage(t *testing.T) {
+	sim := &toolsv1.Simulation{ObjectMeta: metav1.ObjectMeta{Name: "sim"}}
+	sim.Spec.Pipeline = []toolsv1.PipelineStage{{Name: "build"}, {Name: simulateStage}}
+
+	pod := &corev1.Pod{Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{
+		{Name: "stage-build", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled"}}},
+		{Name: simulationContainerName, State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+	}}}
+	if stage := getStuckStage(sim, pod); stage != "build" {
+		t.Fatalf("wanted killed stage to be reported, got %q", stage)
+	}
+
+	pod.Status.ContainerStatuses[1].State = corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{}}
+	if stage := getStuckStage(sim, pod); stage != "" {
+		t.Fatalf("wanted no stuck stage once the next ones exited, got %q", stage)
+	}
+}
+
+func TestShareStageRequests(t *testing.T) {
+	sim := &toolsv1.Simulation{ObjectMeta: metav1.ObjectMeta{Name: "sim"}}
+	sim.Spec.Config.Resources.Requests = corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse("2"),
+		corev1.ResourceMemory: resource.MustParse("4Gi"),
+	}
+	sim.Spec.Pipeline = []toolsv1.PipelineStage{
+		{Name: "build", Command: []string{"true"}, Resources: corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("4")},
+		}},
+		{Name: simulateStage},
+	}
+
+	job, err := getJobSpec(sim, matrixCell{}, "1", defaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := corev1.ResourceList{}
+	for _, c := range job.Spec.Template.Spec.Containers {
+		for name, q := range c.Resources.Requests {
+			sum := requests[name]
+			sum.Add(q)
+			requests[name] = sum
+		}
+	}
+	if cpu := requests[corev1.ResourceCPU]; cpu.Cmp(resource.MustParse("4")) != 0 {
+		t.Fatalf("wanted the pod to request the cpu of the build stage, got %s", cpu.String())
+	}
+	if mem := requests[corev1.ResourceMemory]; mem.Cmp(resource.MustParse("4Gi")) != 0 {
+		t.Fatalf("wanted the pod to request the memory of the simulation, got %s", mem.String())
+	}
+	if cpu := sim.Spec.Config.Resources.Requests[corev1.ResourceCPU]; cpu.String() != "2" {
+		t.Fatalf("wanted the spec to be left unchanged, got %s", cpu.String())
+	}
+
+	if err := validateSimulation(sim, defaultOptions()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Other stages run the command given
+	sim.Spec.Pipeline[0].Command = nil
+	if err := validateSimulation(sim, defaultOptions()); err == nil {
+		t.Fatalf("wanted stage without a command to be rejected")
+	}
+	sim.Spec.Pipeline[0].Command = []string{"true"}
+
+	// The simulation stage is configured through the simulation
+	sim.Spec.Pipeline[1].Image = "alpine"
+	if err := validateSimulation(sim, defaultOptions()); err == nil {
+		t.Fatalf("wanted simulate stage with an image to be rejected")
+	}
+}
+
+func TestUpdateJobStages(t *testing.T) {
+	sim := &toolsv1.Simulation{ObjectMeta: metav1.ObjectMeta{Name: "sim"}}
+	sim.Spec.Pipeline = []toolsv1.PipelineStage{{Name: "build"}, {Name: simulateStage}, {Name: "verify"}}
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: getJobName(sim, "", "1")}}
+	setJobStatus(sim, matrixCell{}, "1", toolsv1.SimulationFailed)
+
+	terminated := func(name string, exitCode int32, reason, message string) corev1.ContainerStatus {
+		return corev1.ContainerStatus{Name: name, State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+			ExitCode: exitCode, Reason: reason, Message: message,
+		}}}
+	}
+	pod := &corev1.Pod{Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{
+		terminated("stage-build", 0, "Completed", ""),
+		terminated(simulationContainerName, 1, "Error", ""),
+		terminated("stage-verify", 0, "Completed", reasonResult+"="+previousStageFailedReason),
+	}}}
+	updateJobStages(sim, job, pod)
+
+	stages := getJobStatus(sim, job.Name).PipelineStages
+	want := []toolsv1.SimStatus{toolsv1.SimulationSucceed, toolsv1.SimulationFailed, toolsv1.SimulationSkipped}
+	for i, s := range stages {
+		if s.Status != want[i] {
+			t.Fatalf("unexpected status of stage %s: %s", s.Name, s.Status)
+		}
+	}
+	if *stages[1].ExitCode != 1 || stages[1].Reason != "Error" {
+		t.Fatalf("unexpected simulate stage %+v", stages[1])
+	}
+
+	// Stages are kept once the pod is gone
+	updateJobStages(sim, job, nil)
+	if getJobStatus(sim, job.Name).PipelineStages[1].Status != toolsv1.SimulationFailed {
+		t.Fatalf("wanted stage status to be kept")
+	}
+}
@@ -0,0 +1,56 @@
+package simulation
+
+import (
+	"fmt"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+)
+
+// profile is a profile written by go test with the given flag.
+type profile struct {
+	flag string
+	artifactFile
+}
+
+// getProfiles returns the profiles written by the simulation, as enabled by
+// the profiling spec or, for benchmarks, the benchmark options.
+func getProfiles(sim *toolsv1.Simulation) []profile {
+	var cpu, mem, block, trace bool
+	if p := sim.Spec.Config.Profiling; p != nil {
+		cpu, mem, block, trace = p.CPU, p.Memory, p.Block, p.Trace
+	}
+	if o := sim.Spec.Config.BenchmarkOptions; o != nil && getSimulationMode(sim).benchmark {
+		cpu, mem = cpu || o.CPUProfile, mem || o.MemProfile
+	}
+
+	var profiles []profile
+	add := func(enabled bool, flag string, file artifactFile) {
+		if enabled {
+			profiles = append(profiles, profile{flag: flag, artifactFile: file})
+		}
+	}
+	// pprof profiles are gzip compressed already, unlike traces
+	add(cpu, "-cpuprofile", artifactFile{name: cpuProfileArtifactName, path: cpuProfilePath, compressed: true})
+	add(mem, "-memprofile", artifactFile{name: memProfileArtifactName, path: memProfilePath, compressed: true})
+	add(block, "-blockprofile", artifactFile{name: blockProfileArtifactName, path: blockProfilePath, compressed: true})
+	add(trace, "-trace", artifactFile{name: traceArtifactName, path: tracePath})
+	return profiles
+}
+
+// getProfileFiles returns the files of the profiles written by the simulation.
+func getProfileFiles(sim *toolsv1.Simulation) []artifactFile {
+	files := make([]artifactFile, 0)
+	for _, p := range getProfiles(sim) {
+		files = append(files, p.artifactFile)
+	}
+	return files
+}
+
+// getProfilingFlags returns the go test flags writing the profiles.
+func getProfilingFlags(sim *toolsv1.Simulation) string {
+	flags := ""
+	for _, p := range getProfiles(sim) {
+		flags += fmt.Sprintf(" %s %s", p.flag, p.path)
+	}
+	return flags
+}
@@ -0,0 +1,76 @@
+package simulation
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+)
+
+func TestProfiling(t *testing.T) {
+	sim := &toolsv1.Simulation{ObjectMeta: metav1.ObjectMeta{Name: "sim", Namespace: "default"}}
+	sim.Spec.Config.Mode = toolsv1.FullAppMode
+	sim.Spec.Config.Test = DefaultTest
+	sim.Spec.Config.Profiling = &toolsv1.ProfilingSpec{CPU: true, Block: true, Trace: true}
+
+	opts := defaultOptions()
+	opts.LogBackupEnabled = true
+	job, err := getJobSpec(sim, matrixCell{}, "7", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := job.Spec.Template.Spec.Containers[0].Args[2]
+	for _, s := range []string{"-cpuprofile " + cpuProfilePath, "-blockprofile " + blockProfilePath, "-trace " + tracePath,
+		"-content-type application/octet-stream", "-compressed " + cpuProfileArtifactName + "=" + cpuProfilePath, traceArtifactName + "=" + tracePath} {
+		if !strings.Contains(cmd, s) {
+			t.Fatalf("wanted %s in command, got %s", s, cmd)
+		}
+	}
+	if strings.Contains(cmd, "-memprofile") {
+		t.Fatalf("wanted no memory profile, got %s", cmd)
+	}
+
+	// Uploaded profiles are linked from the job status
+	store := newMemoryStore()
+	r := &SimulationReconciler{store: store}
+	sim.Status.JobStatus = []toolsv1.JobStatus{{Name: "sim-7", Seed: "7"}}
+	for _, file := range append(getArtifactFiles()[:1], getProfileFiles(sim)[0], getProfileFiles(sim)[2]) {
+		if err := store.Put(context.Background(), getArtifactKey(sim, "", "7", file), strings.NewReader("data"), PutOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	job = &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "sim-7"}, Status: batchv1.JobStatus{Succeeded: 1}}
+	if err := r.updateJobArtifacts(context.Background(), sim, job); err != nil {
+		t.Fatal(err)
+	}
+	status := sim.Status.JobStatus[0]
+	if !status.ArtifactsCollected {
+		t.Fatal("wanted artifacts to be collected")
+	}
+	if len(status.Artifacts) != 1 || status.Artifacts[0].Name != stateArtifactName {
+		t.Fatalf("unexpected artifacts %+v", status.Artifacts)
+	}
+	if len(status.Profiles) != 2 || status.Profiles[0].Name != cpuProfileArtifactName || status.Profiles[1].Name != traceArtifactName {
+		t.Fatalf("unexpected profiles %+v", status.Profiles)
+	}
+	// pprof profiles are stored as they are written
+	if key := status.Profiles[0].Key; key != "default/sim/7/"+cpuProfileArtifactName {
+		t.Fatalf("wanted cpu profile to be stored as is, got %s", key)
+	}
+	if key := status.Profiles[1].Key; key != "default/sim/7/"+traceArtifactName+".gz" {
+		t.Fatalf("wanted trace to be compressed, got %s", key)
+	}
+
+	// Profiles cannot be uploaded without pod artifacts
+	if err := validateSimulation(sim, defaultOptions()); err == nil {
+		t.Fatalf("wanted profiling without pod artifacts to be rejected")
+	}
+	if err := validateSimulation(sim, opts); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,108 @@
+package simulation
+
+import (
+	"context"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+)
+
+// rerunSeeds runs again the finished seeds requested with RerunAnnotation,
+// recording their previous results, and clears the annotation. It returns
+// whether the simulation was updated.
+func (r *SimulationReconciler) rerunSeeds(ctx context.Context, sim *toolsv1.Simulation) (bool, error) {
+	value, ok := sim.Annotations[RerunAnnotation]
+	if !ok {
+		return false, nil
+	}
+	log := r.log.WithValues("simulation", sim.Name)
+
+	var seeds []string
+	for _, seed := range strings.Split(value, ",") {
+		if seed = strings.TrimSpace(seed); seed != "" {
+			seeds = append(seeds, seed)
+		}
+	}
+
+	for i := range sim.Status.JobStatus {
+		status := &sim.Status.JobStatus[i]
+		switch {
+		case !contains(getActiveSeeds(sim), status.Seed):
+			continue
+		case !hasMatrixCell(sim, status.Cell):
+			continue
+		case contains(seeds, rerunFailed) && isJobFailed(status.Status):
+		case contains(seeds, status.Seed):
+		default:
+			continue
+		}
+
+		// Running seeds are not interrupted
+		if !isJobFinished(status.Status) && status.Status != toolsv1.SimulationCancelled {
+			log.Info("ignoring rerun of unfinished seed", "seed", status.Seed)
+			continue
+		}
+
+		log.Info("rerunning seed", "seed", status.Seed)
+		job, err := r.GetJob(ctx, sim, status.Cell, status.Seed)
+		if err != nil {
+			return false, err
+		}
+		var jobUID types.UID
+		if job != nil {
+			jobUID = job.UID
+			if err := r.MaybeDeleteJob(ctx, sim, status.Cell, status.Seed); err != nil {
+				return false, err
+			}
+		}
+
+		attempts := append(status.Attempts, toolsv1.JobAttempt{
+			Status:    status.Status,
+			JobUID:    jobUID,
+			Commit:    status.Commit,
+			Artifacts: status.Artifacts,
+			Profiles:  status.Profiles,
+			Logs:      status.Logs,
+		})
+		resetJobStatus(status)
+		status.Attempts = attempts
+		status.Status = toolsv1.SimulationPending
+	}
+
+	if err := r.Status().Update(ctx, sim); err != nil {
+		return false, err
+	}
+
+	delete(sim.Annotations, RerunAnnotation)
+	return true, r.Update(ctx, sim)
+}
+
+// isPreviousAttempt returns whether the job ran a previous attempt of the seed,
+// i.e. it is still listed after being deleted to run the seed again.
+func isPreviousAttempt(status *toolsv1.JobStatus, job *batchv1.Job) bool {
+	if status == nil {
+		return false
+	}
+	for _, a := range status.Attempts {
+		if a.JobUID != "" && a.JobUID == job.UID {
+			return true
+		}
+	}
+	return false
+}
+
+// resetJobStatus clears the results of the run of a seed before it runs again,
+// keeping the history of previous attempts.
+func resetJobStatus(status *toolsv1.JobStatus) {
+	*status = toolsv1.JobStatus{
+		Name:       status.Name,
+		Seed:       status.Seed,
+		Stage:      status.Stage,
+		Cell:       status.Cell,
+		Parameters: status.Parameters,
+		Attempts:   status.Attempts,
+	}
+}
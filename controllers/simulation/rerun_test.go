@@ -0,0 +1,87 @@
+package simulation
+
+import (
+	"context"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+)
+
+func TestRerunSeeds(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = toolsv1.AddToScheme(scheme)
+
+	sim := &toolsv1.Simulation{ObjectMeta: metav1.ObjectMeta{
+		Name:        "sim",
+		Namespace:   "default",
+		UID:         "sim",
+		Annotations: map[string]string{RerunAnnotation: "failed, 3"},
+	}}
+	sim.Spec.Config.Seeds = []string{"1", "2", "3", "4"}
+	sim.Status.JobStatus = []toolsv1.JobStatus{
+		{Name: getJobName(sim, "", "1"), Seed: "1", Status: toolsv1.SimulationFailed, Commit: "abc"},
+		{Name: getJobName(sim, "", "2"), Seed: "2", Status: toolsv1.SimulationSucceed},
+		{Name: getJobName(sim, "", "3"), Seed: "3", Status: toolsv1.SimulationSucceed},
+		{Name: getJobName(sim, "", "4"), Seed: "4", Status: toolsv1.SimulationRunning},
+	}
+
+	objs := []runtime.Object{sim.DeepCopy()}
+	owner := []metav1.OwnerReference{*metav1.NewControllerRef(sim, toolsv1.GroupVersion.WithKind("Simulation"))}
+	for _, s := range sim.Status.JobStatus {
+		objs = append(objs, &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: s.Name, Namespace: sim.Namespace, UID: types.UID(s.Name), OwnerReferences: owner}})
+	}
+
+	r := &SimulationReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme, objs...),
+		log:    zap.New(),
+	}
+
+	updated, err := r.rerunSeeds(ctx, sim)
+	if err != nil || !updated {
+		t.Fatalf("wanted simulation to be updated, got %v %v", updated, err)
+	}
+
+	if _, ok := sim.Annotations[RerunAnnotation]; ok {
+		t.Fatalf("wanted annotation to be cleared")
+	}
+
+	for _, s := range sim.Status.JobStatus {
+		rerun := s.Seed == "1" || s.Seed == "3"
+		if rerun != (len(s.Attempts) == 1) {
+			t.Fatalf("unexpected attempts for seed %s: %+v", s.Seed, s.Attempts)
+		}
+
+		err := r.Get(ctx, types.NamespacedName{Namespace: sim.Namespace, Name: s.Name}, &batchv1.Job{})
+		if rerun != errors.IsNotFound(err) {
+			t.Fatalf("unexpected job for seed %s: %v", s.Seed, err)
+		}
+	}
+
+	first := getJobStatus(sim, getJobName(sim, "", "1"))
+	if first.Status != toolsv1.SimulationPending || first.Commit != "" || first.Attempts[0].Commit != "abc" {
+		t.Fatalf("unexpected status %+v", first)
+	}
+
+	// The deleted job may still be listed until it is gone
+	if !isPreviousAttempt(first, &batchv1.Job{ObjectMeta: metav1.ObjectMeta{UID: types.UID(first.Name)}}) {
+		t.Fatalf("wanted the job of the previous attempt to be ignored, got %+v", first.Attempts)
+	}
+	if isPreviousAttempt(first, &batchv1.Job{ObjectMeta: metav1.ObjectMeta{UID: "new"}}) {
+		t.Fatalf("wanted the job of the new attempt to be used")
+	}
+
+	if prefix := getArtifactsPrefix(sim, "", "1"); prefix != "default/sim/1/attempt-1" {
+		t.Fatalf("wanted artifacts of the rerun to be stored apart, got %s", prefix)
+	}
+}
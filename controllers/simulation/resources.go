@@ -0,0 +1,144 @@
+package simulation
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+)
+
+// Resource usage reported by the simulation container, as read from its
+// cgroup, either v2 or v1.
+const (
+	cgroupDir = "/sys/fs/cgroup"
+
+	// peakMemoryResult holds the peak memory usage in bytes.
+	peakMemoryResult = "peakMemory"
+	// cpuTimeResult holds the CPU time used in microseconds.
+	cpuTimeResult = "cpuTime"
+)
+
+// Headroom, in percent of the resources used, of the suggested resources.
+// The memory of seeds killed for exceeding their limit is suggested to grow
+// by oomKilledGrowth percent of the limit.
+const (
+	memoryRequestHeadroom = 120
+	memoryLimitHeadroom   = 150
+	cpuRequestHeadroom    = 120
+	cpuLimitHeadroom      = 200
+	oomKilledGrowth       = 200
+
+	// cpuStep rounds up suggested CPU, in millicores.
+	cpuStep = 50
+)
+
+// getResourceUsageCmd returns the command reporting the peak memory usage
+// and the CPU time of the container, including building the simulation, in
+// the termination message of the simulation container.
+func getResourceUsageCmd() string {
+	return fmt.Sprintf("peak=$(cat %[1]s/memory.peak %[1]s/memory/memory.max_usage_in_bytes 2>/dev/null | head -n 1); "+
+		"usage=; if [ -f %[1]s/cpu.stat ]; then usage=$(awk '/^usage_usec/ {print $2}' %[1]s/cpu.stat); "+
+		"elif [ -f %[1]s/cpuacct/cpuacct.usage ]; then usage=$(( $(cat %[1]s/cpuacct/cpuacct.usage) / 1000 )); fi; "+
+		"[ -n \"$peak\" ] && echo %[2]s=$peak >> /dev/termination-log; "+
+		"[ -n \"$usage\" ] && echo %[3]s=$usage >> /dev/termination-log; ",
+		cgroupDir, peakMemoryResult, cpuTimeResult)
+}
+
+// updateJobResources records the resources used by the simulation container
+// of the job once it terminated.
+func updateJobResources(sim *toolsv1.Simulation, job *batchv1.Job, pod *corev1.Pod) {
+	status := getJobStatus(sim, job.Name)
+	if status == nil || pod == nil || status.Resources != nil {
+		return
+	}
+
+	for _, cs := range pod.Status.ContainerStatuses {
+		t := cs.State.Terminated
+		if cs.Name != simulationContainerName || t == nil {
+			continue
+		}
+
+		usage := &toolsv1.ResourceUsage{OOMKilled: t.Reason == oomKilledReason}
+		if !t.StartedAt.IsZero() && !t.FinishedAt.IsZero() {
+			usage.WallTime = &metav1.Duration{Duration: t.FinishedAt.Sub(t.StartedAt.Time)}
+		}
+
+		results := parseResults(t.Message)
+		if v, err := strconv.ParseInt(results[peakMemoryResult], 10, 64); err == nil {
+			usage.PeakMemory = resource.NewQuantity(v, resource.BinarySI)
+		}
+		if v, err := strconv.ParseInt(results[cpuTimeResult], 10, 64); err == nil {
+			usage.CPUTime = &metav1.Duration{Duration: time.Duration(v) * time.Microsecond}
+		}
+		status.Resources = usage
+	}
+}
+
+// updateSuggestedResources suggests resources for the next run of the
+// simulation, sized after the seeds which used the most memory and CPU.
+func updateSuggestedResources(sim *toolsv1.Simulation) {
+	var (
+		peakMemory, milliCPU int64
+		reported             bool
+	)
+	for _, s := range sim.Status.JobStatus {
+		u := s.Resources
+		if u == nil {
+			continue
+		}
+		reported = true
+
+		memory := int64(0)
+		if u.PeakMemory != nil {
+			memory = u.PeakMemory.Value()
+		}
+		// The memory used by killed seeds is unknown, but over the limit
+		if limit := sim.Spec.Config.Resources.Limits.Memory(); u.OOMKilled && !limit.IsZero() {
+			memory = limit.Value() * oomKilledGrowth / 100
+		}
+		if memory > peakMemory {
+			peakMemory = memory
+		}
+
+		if u.CPUTime != nil && u.WallTime != nil && u.WallTime.Duration > 0 {
+			m := int64(u.CPUTime.Duration) * 1000 / int64(u.WallTime.Duration)
+			if m > milliCPU {
+				milliCPU = m
+			}
+		}
+	}
+	if !reported {
+		return
+	}
+
+	suggested := &corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{},
+		Limits:   corev1.ResourceList{},
+	}
+	if peakMemory > 0 {
+		suggested.Requests[corev1.ResourceMemory] = memoryQuantity(peakMemory * memoryRequestHeadroom / 100)
+		suggested.Limits[corev1.ResourceMemory] = memoryQuantity(peakMemory * memoryLimitHeadroom / 100)
+	}
+	if milliCPU > 0 {
+		suggested.Requests[corev1.ResourceCPU] = cpuQuantity(milliCPU * cpuRequestHeadroom / 100)
+		suggested.Limits[corev1.ResourceCPU] = cpuQuantity(milliCPU * cpuLimitHeadroom / 100)
+	}
+	sim.Status.SuggestedResources = suggested
+}
+
+// memoryQuantity returns the given bytes rounded up to mebibytes.
+func memoryQuantity(bytes int64) resource.Quantity {
+	const mi = 1 << 20
+	return *resource.NewQuantity((bytes+mi-1)/mi*mi, resource.BinarySI)
+}
+
+// cpuQuantity returns the given millicores rounded up to cpuStep.
+func cpuQuantity(milliCPU int64) resource.Quantity {
+	return *resource.NewMilliQuantity((milliCPU+cpuStep-1)/cpuStep*cpuStep, resource.DecimalSI)
+}
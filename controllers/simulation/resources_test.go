@@ -0,0 +1,96 @@
+package simulation
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+)
+
+func TestGetResourceUsageCmd(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not available")
+	}
+
+	dir, err := ioutil.TempDir("", "cgroup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// cgroup v2 files
+	if err := ioutil.WriteFile(filepath.Join(dir, "memory.peak"), []byte("1073741824\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "cpu.stat"), []byte("usage_usec 90000000\nuser_usec 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	script := strings.NewReplacer(cgroupDir, dir, "/dev/termination-log", "/dev/stdout").Replace(getResourceUsageCmd())
+	out, err := exec.Command("bash", "-c", script).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := parseResults(string(out))
+	if results[peakMemoryResult] != "1073741824" || results[cpuTimeResult] != "90000000" {
+		t.Fatalf("unexpected results %v", results)
+	}
+}
+
+func TestUpdateJobResources(t *testing.T) {
+	sim := &toolsv1.Simulation{ObjectMeta: metav1.ObjectMeta{Name: "sim"}}
+	sim.Spec.Config.Resources = DefaultResources
+	for _, seed := range []string{"1", "2"} {
+		setJobStatus(sim, matrixCell{}, seed, toolsv1.SimulationFailed)
+	}
+
+	start := metav1.NewTime(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	terminated := func(seed, reason, message string) {
+		job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: getJobName(sim, "", seed)}}
+		pod := &corev1.Pod{Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+			Name: simulationContainerName,
+			State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+				Reason:     reason,
+				Message:    message,
+				StartedAt:  start,
+				FinishedAt: metav1.NewTime(start.Add(time.Minute)),
+			}},
+		}}}}
+		updateJobResources(sim, job, pod)
+	}
+
+	terminated("1", "Completed", peakMemoryResult+"=104857600\n"+cpuTimeResult+"=90000000\n")
+	u := getJobStatus(sim, getJobName(sim, "", "1")).Resources
+	if u == nil || u.PeakMemory.Value() != 100<<20 || u.CPUTime.Duration != 90*time.Second || u.WallTime.Duration != time.Minute {
+		t.Fatalf("unexpected usage %+v", u)
+	}
+
+	updateSuggestedResources(sim)
+	s := sim.Status.SuggestedResources
+	if m := s.Requests[corev1.ResourceMemory]; m.String() != "120Mi" {
+		t.Fatalf("unexpected memory request %s", m.String())
+	}
+	if c := s.Requests[corev1.ResourceCPU]; c.String() != "1800m" {
+		t.Fatalf("unexpected cpu request %s", c.String())
+	}
+
+	// Killed seeds grow the memory beyond the limit
+	terminated("2", oomKilledReason, "")
+	if u := getJobStatus(sim, getJobName(sim, "", "2")).Resources; u == nil || !u.OOMKilled {
+		t.Fatalf("wanted seed to be OOMKilled, got %+v", u)
+	}
+	updateSuggestedResources(sim)
+	if m := sim.Status.SuggestedResources.Limits[corev1.ResourceMemory]; m.Cmp(resource.MustParse("3Gi")) != 0 {
+		t.Fatalf("unexpected memory limit %s", m.String())
+	}
+}
@@ -0,0 +1,251 @@
+package simulation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+)
+
+// artifactsGCInterval is the interval at which expired and orphaned artifacts are removed.
+const artifactsGCInterval = time.Hour
+
+// tombstone is stored under the prefix of a deleted simulation whose
+// artifacts are kept.
+type tombstone struct {
+	Name          string    `json:"name"`
+	Namespace     string    `json:"namespace"`
+	UID           types.UID `json:"uid"`
+	DeletedAt     time.Time `json:"deletedAt"`
+	RetentionDays int       `json:"retentionDays,omitempty"`
+}
+
+// ensureArtifactsFinalizer adds the finalizer applying the retention policy on
+// deletion. It returns whether the simulation was updated.
+func (r *SimulationReconciler) ensureArtifactsFinalizer(ctx context.Context, sim *toolsv1.Simulation) (bool, error) {
+	if contains(sim.Finalizers, ArtifactsFinalizer) {
+		return false, nil
+	}
+
+	// Remove the tombstone of a previous simulation with the same name
+	if err := r.store.Delete(ctx, getTombstoneKey(sim)); err != nil {
+		return false, err
+	}
+
+	sim.Finalizers = append(sim.Finalizers, ArtifactsFinalizer)
+	return true, r.Update(ctx, sim)
+}
+
+// finalizeArtifacts deletes or tags the artifacts of a deleted simulation,
+// according to its retention policy, and removes the finalizer.
+func (r *SimulationReconciler) finalizeArtifacts(ctx context.Context, sim *toolsv1.Simulation) error {
+	if !contains(sim.Finalizers, ArtifactsFinalizer) {
+		return nil
+	}
+
+	if r.store != nil {
+		if sim.Spec.Artifacts.Retention.DeleteWithSimulation {
+			// Logs still being captured would be uploaded again otherwise
+			if r.logs != nil {
+				r.logs.Stop(sim)
+			}
+
+			r.log.WithValues("simulation", sim.Name).Info("deleting artifacts")
+			if err := deleteArtifacts(ctx, r.store, getArtifactsRoot(sim.Namespace, sim.Name), time.Time{}); err != nil {
+				return err
+			}
+		} else {
+			b, err := json.Marshal(tombstone{
+				Name:          sim.Name,
+				Namespace:     sim.Namespace,
+				UID:           sim.UID,
+				DeletedAt:     time.Now().UTC(),
+				RetentionDays: sim.Spec.Artifacts.Retention.Days,
+			})
+			if err != nil {
+				return err
+			}
+			if err := r.store.Put(ctx, getTombstoneKey(sim), bytes.NewReader(b), PutOptions{ContentType: "application/json"}); err != nil {
+				return err
+			}
+		}
+	}
+
+	finalizers := make([]string, 0, len(sim.Finalizers))
+	for _, f := range sim.Finalizers {
+		if f != ArtifactsFinalizer {
+			finalizers = append(finalizers, f)
+		}
+	}
+	sim.Finalizers = finalizers
+	return r.Update(ctx, sim)
+}
+
+// artifactsCollector periodically removes the artifacts which expired according
+// to the retention of their simulation and, if enabled, the artifacts of
+// simulations which no longer exist.
+type artifactsCollector struct {
+	log    logr.Logger
+	client client.Client
+	store  ArtifactStore
+
+	// orphanedRetention is the time after which the artifacts of simulations
+	// that no longer exist are deleted. Zero keeps them forever.
+	orphanedRetention time.Duration
+}
+
+// Start runs the collector until stop is closed.
+func (c *artifactsCollector) Start(stop <-chan struct{}) error {
+	wait.Until(func() {
+		if err := c.collect(context.Background(), time.Now()); err != nil {
+			c.log.Error(err, "error collecting artifacts")
+		}
+	}, artifactsGCInterval, stop)
+	return nil
+}
+
+func (c *artifactsCollector) collect(ctx context.Context, now time.Time) error {
+	var sims toolsv1.SimulationList
+	if err := c.client.List(ctx, &sims); err != nil {
+		return err
+	}
+
+	retention := make(map[string]int)
+	for _, sim := range sims.Items {
+		retention[getArtifactsRoot(sim.Namespace, sim.Name)] = sim.Spec.Artifacts.Retention.Days
+	}
+
+	// Artifacts are stored under the namespace and name of their simulation.
+	// Only the prefixes are listed here, the objects are listed only for the
+	// simulations whose artifacts may be deleted.
+	namespaces, err := c.store.ListPrefixes(ctx, "")
+	if err != nil {
+		return err
+	}
+	var roots []string
+	for _, ns := range namespaces {
+		prefixes, err := c.store.ListPrefixes(ctx, ns)
+		if err != nil {
+			return err
+		}
+		roots = append(roots, prefixes...)
+	}
+
+	for _, root := range roots {
+		log := c.log.WithValues("prefix", root)
+
+		var before time.Time
+		if days, ok := retention[root]; ok {
+			if days == 0 {
+				continue
+			}
+			before = now.AddDate(0, 0, -days)
+		} else {
+			// The simulation no longer exists
+			t, err := c.getTombstone(ctx, root)
+			if err != nil {
+				return err
+			}
+
+			switch {
+			case t != nil && t.RetentionDays > 0:
+				before = now.AddDate(0, 0, -t.RetentionDays)
+			case t == nil && c.orphanedRetention > 0:
+				orphaned, err := isOrphaned(ctx, c.store, root, now.Add(-c.orphanedRetention))
+				if err != nil {
+					return err
+				}
+				if !orphaned {
+					continue
+				}
+				log.Info("deleting orphaned artifacts")
+				if err := deleteArtifacts(ctx, c.store, root, time.Time{}); err != nil {
+					return err
+				}
+				continue
+			default:
+				continue
+			}
+		}
+
+		log.Info("deleting expired artifacts", "before", before)
+		if err := deleteArtifacts(ctx, c.store, root, before); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *artifactsCollector) getTombstone(ctx context.Context, root string) (*tombstone, error) {
+	rc, err := c.store.Get(ctx, root+tombstoneName)
+	if err == ErrArtifactNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+
+	var t tombstone
+	if err := json.Unmarshal(b, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// isOrphaned returns whether no object stored under prefix was modified after
+// the given time.
+func isOrphaned(ctx context.Context, store ArtifactStore, prefix string, after time.Time) (bool, error) {
+	objects, err := store.List(ctx, prefix)
+	if err != nil {
+		return false, err
+	}
+
+	for _, obj := range objects {
+		if obj.LastModified.After(after) {
+			return false, nil
+		}
+	}
+	return len(objects) > 0, nil
+}
+
+// deleteArtifacts deletes the objects stored under prefix which were last
+// modified before the given time, or every object if it is zero.
+func deleteArtifacts(ctx context.Context, store ArtifactStore, prefix string, before time.Time) error {
+	objects, err := store.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objects {
+		if !before.IsZero() && !obj.LastModified.Before(before) {
+			continue
+		}
+		if err := store.Delete(ctx, obj.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getArtifactsRoot returns the prefix under which every artifact of the
+// simulation with the given namespace and name is stored.
+func getArtifactsRoot(namespace, name string) string {
+	return namespace + "/" + name + "/"
+}
+
+func getTombstoneKey(sim *toolsv1.Simulation) string {
+	return getArtifactsRoot(sim.Namespace, sim.Name) + tombstoneName
+}
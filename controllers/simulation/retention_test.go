@@ -0,0 +1,105 @@
+package simulation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+)
+
+func TestArtifactsCollector(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+
+	scheme := runtime.NewScheme()
+	if err := toolsv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	kept := &toolsv1.Simulation{ObjectMeta: metav1.ObjectMeta{Name: "kept", Namespace: "default"}}
+	expiring := &toolsv1.Simulation{ObjectMeta: metav1.ObjectMeta{Name: "expiring", Namespace: "default"}}
+	expiring.Spec.Artifacts.Retention.Days = 1
+
+	c := &artifactsCollector{
+		log:               zap.New(),
+		client:            fake.NewFakeClientWithScheme(scheme, kept, expiring),
+		store:             store,
+		orphanedRetention: 3 * 24 * time.Hour,
+	}
+
+	for _, name := range []string{"kept", "expiring", "orphan", "tombstoned"} {
+		if err := store.Put(ctx, "default/"+name+"/1/simulation.log.gz", strings.NewReader("logs"), PutOptions{}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	b, _ := json.Marshal(tombstone{Name: "tombstoned", RetentionDays: 2})
+	if err := store.Put(ctx, "default/tombstoned/"+tombstoneName, bytes.NewReader(b), PutOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	exists := func(name string) bool {
+		objects, err := store.List(ctx, "default/"+name+"/1/")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return len(objects) > 0
+	}
+
+	if err := c.collect(ctx, time.Now().Add(36*time.Hour)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !exists("kept") || exists("expiring") || !exists("orphan") || !exists("tombstoned") {
+		t.Fatalf("only expiring artifacts should have been deleted")
+	}
+
+	if err := c.collect(ctx, time.Now().Add(4*24*time.Hour)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !exists("kept") || exists("orphan") || exists("tombstoned") {
+		t.Fatalf("only kept artifacts should remain")
+	}
+}
+
+func TestFinalizeArtifacts(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+
+	scheme := runtime.NewScheme()
+	if err := toolsv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sim := &toolsv1.Simulation{ObjectMeta: metav1.ObjectMeta{Name: "sim", Namespace: "default", Finalizers: []string{ArtifactsFinalizer}}}
+	sim.Spec.Artifacts.Retention.DeleteWithSimulation = true
+	r := &SimulationReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme, sim),
+		log:    zap.New(),
+		store:  store,
+	}
+
+	// Simulations with the same name in other namespaces keep their artifacts
+	for _, ns := range []string{"default", "other"} {
+		if err := store.Put(ctx, ns+"/sim/1/simulation.log.gz", strings.NewReader("logs"), PutOptions{}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if err := r.finalizeArtifacts(ctx, sim); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := store.Stat(ctx, "default/sim/1/simulation.log.gz"); err != ErrArtifactNotFound {
+		t.Fatalf("wanted artifacts to be deleted, got %v", err)
+	}
+	if _, err := store.Stat(ctx, "other/sim/1/simulation.log.gz"); err != nil {
+		t.Fatalf("wanted artifacts of the other namespace to be kept, got %v", err)
+	}
+}
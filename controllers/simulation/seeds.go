@@ -0,0 +1,179 @@
+package simulation
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+)
+
+const (
+	// maxGeneratedSeeds bounds the number of seeds generated by a strategy.
+	maxGeneratedSeeds = 1000
+
+	// seedsRetryInterval is the interval at which a referenced simulation is
+	// checked until its failed seeds are available.
+	seedsRetryInterval = time.Minute
+
+	// noFailedSeedsReason is the reason of the SeedsGenerated condition when
+	// the referenced simulation had no failed seeds to run again.
+	noFailedSeedsReason = "NoFailedSeeds"
+)
+
+// getSeeds returns the seeds to run, either listed in spec or generated
+// according to the seed strategy. Generated seeds are recorded in status and
+// never generated again. When they are not available yet, or the strategy is
+// invalid, no seeds are returned and the SeedsGenerated condition tells why,
+// along with the time after which to check again, if any.
+func (r *SimulationReconciler) getSeeds(ctx context.Context, sim *toolsv1.Simulation) ([]string, time.Duration, error) {
+	strategy := sim.Spec.Config.SeedStrategy
+	if strategy == nil {
+		return sim.Spec.Config.Seeds, 0, nil
+	}
+
+	if seedsResolved(sim) || noFailedSeeds(sim) {
+		return sim.Status.Seeds, 0, nil
+	}
+
+	var (
+		seeds []string
+		err   error
+	)
+	switch strategy.Type {
+	case toolsv1.RandomSeeds:
+		if sim.Status.MasterSeed == nil {
+			master := time.Now().UnixNano()
+			if strategy.MasterSeed != nil {
+				master = *strategy.MasterSeed
+			}
+			sim.Status.MasterSeed = &master
+		}
+		seeds, err = getRandomSeeds(*sim.Status.MasterSeed, strategy.Count)
+	case toolsv1.RangeSeeds:
+		seeds, err = getRangeSeeds(strategy.Start, strategy.End)
+	case toolsv1.PreviousFailuresSeeds:
+		var ready bool
+		if seeds, ready, err = r.getPreviousFailures(ctx, sim); err == nil && !ready {
+			return nil, seedsRetryInterval, nil
+		}
+		// There is nothing to run, the simulation succeeds without jobs
+		if err == nil && len(seeds) == 0 {
+			setCondition(sim, toolsv1.SeedsGenerated, corev1.ConditionFalse, noFailedSeedsReason,
+				fmt.Sprintf("simulation %s had no failed seeds", strategy.Simulation))
+			return nil, 0, nil
+		}
+	default:
+		err = fmt.Errorf("unknown seed strategy %q", strategy.Type)
+	}
+
+	if err != nil {
+		// Invalid strategies are reported instead of being retried
+		setCondition(sim, toolsv1.SeedsGenerated, corev1.ConditionFalse, "InvalidSeedStrategy", err.Error())
+		return nil, 0, nil
+	}
+
+	sim.Status.Seeds = seeds
+	setCondition(sim, toolsv1.SeedsGenerated, corev1.ConditionTrue, "Generated", fmt.Sprintf("generated %d seeds", len(seeds)))
+	return seeds, 0, nil
+}
+
+// seedsResolved returns whether the seeds to run are known, so that jobs of
+// seeds no longer run can be deleted.
+func seedsResolved(sim *toolsv1.Simulation) bool {
+	if sim.Spec.Config.SeedStrategy == nil {
+		return true
+	}
+	c := getCondition(sim, toolsv1.SeedsGenerated)
+	return c != nil && c.Status == corev1.ConditionTrue
+}
+
+// noFailedSeeds returns whether the seeds were to be taken from the failures of
+// a simulation which had none.
+func noFailedSeeds(sim *toolsv1.Simulation) bool {
+	c := getCondition(sim, toolsv1.SeedsGenerated)
+	return c != nil && c.Status == corev1.ConditionFalse && c.Reason == noFailedSeedsReason
+}
+
+// getPreviousFailures returns the seeds which failed in the referenced
+// simulation, once it finished. Seeds which failed in several cells of the
+// matrix are returned once.
+func (r *SimulationReconciler) getPreviousFailures(ctx context.Context, sim *toolsv1.Simulation) ([]string, bool, error) {
+	name := sim.Spec.Config.SeedStrategy.Simulation
+	if name == "" {
+		return nil, false, fmt.Errorf("a simulation is required")
+	}
+
+	var previous toolsv1.Simulation
+	if err := r.Get(ctx, types.NamespacedName{Namespace: sim.Namespace, Name: name}, &previous); errors.IsNotFound(err) {
+		setCondition(sim, toolsv1.SeedsGenerated, corev1.ConditionFalse, "SimulationNotFound",
+			fmt.Sprintf("simulation %s not found", name))
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	switch previous.Status.Status {
+	case toolsv1.SimulationSucceed, toolsv1.SimulationFailed, toolsv1.SimulationCancelled:
+	default:
+		setCondition(sim, toolsv1.SeedsGenerated, corev1.ConditionFalse, "SimulationNotFinished",
+			fmt.Sprintf("waiting for simulation %s to finish", name))
+		return nil, false, nil
+	}
+
+	seeds := make([]string, 0)
+	for _, s := range previous.Status.JobStatus {
+		if isJobFailed(s.Status) && !contains(seeds, s.Seed) {
+			seeds = append(seeds, s.Seed)
+		}
+	}
+	return seeds, true, nil
+}
+
+// getRandomSeeds returns count distinct non-negative seeds generated from master.
+func getRandomSeeds(master int64, count int) ([]string, error) {
+	if count < 1 || count > maxGeneratedSeeds {
+		return nil, fmt.Errorf("count must be between 1 and %d", maxGeneratedSeeds)
+	}
+
+	rnd := rand.New(rand.NewSource(master))
+	seen := make(map[int64]bool, count)
+	seeds := make([]string, 0, count)
+	for len(seeds) < count {
+		seed := rnd.Int63()
+		if seen[seed] {
+			continue
+		}
+		seen[seed] = true
+		seeds = append(seeds, strconv.FormatInt(seed, 10))
+	}
+	return seeds, nil
+}
+
+// getRangeSeeds returns the seeds from start to end, inclusive.
+func getRangeSeeds(start, end int64) ([]string, error) {
+	if end < start || end-start >= maxGeneratedSeeds {
+		return nil, fmt.Errorf("range must hold between 1 and %d seeds", maxGeneratedSeeds)
+	}
+
+	seeds := make([]string, 0, end-start+1)
+	for seed := start; seed <= end; seed++ {
+		seeds = append(seeds, strconv.FormatInt(seed, 10))
+	}
+	return seeds, nil
+}
+
+// getActiveSeeds returns the seeds listed in spec or, when a seed strategy is
+// set, the seeds generated so far.
+func getActiveSeeds(sim *toolsv1.Simulation) []string {
+	if sim.Spec.Config.SeedStrategy != nil {
+		return sim.Status.Seeds
+	}
+	return sim.Spec.Config.Seeds
+}
@@ -0,0 +1,123 @@
+package simulation
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+)
+
+func TestGetSeeds(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = toolsv1.AddToScheme(scheme)
+
+	previous := &toolsv1.Simulation{ObjectMeta: metav1.ObjectMeta{Name: "previous", Namespace: "default"}}
+	previous.Status.Status = toolsv1.SimulationRunning
+	previous.Status.JobStatus = []toolsv1.JobStatus{
+		{Seed: "1", Status: toolsv1.SimulationFailed},
+		{Seed: "2", Status: toolsv1.SimulationSucceed},
+		{Seed: "3", Status: toolsv1.SimulationFailed},
+		{Seed: "3", Cell: "other", Status: toolsv1.SimulationFailed},
+	}
+
+	succeeded := &toolsv1.Simulation{ObjectMeta: metav1.ObjectMeta{Name: "succeeded", Namespace: "default"}}
+	succeeded.Status.Status = toolsv1.SimulationSucceed
+	succeeded.Status.JobStatus = []toolsv1.JobStatus{{Seed: "1", Status: toolsv1.SimulationSucceed}}
+
+	r := &SimulationReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme, previous, succeeded),
+		log:    zap.New(),
+	}
+
+	newSim := func(strategy toolsv1.SeedStrategy) *toolsv1.Simulation {
+		sim := &toolsv1.Simulation{ObjectMeta: metav1.ObjectMeta{Name: "sim", Namespace: "default"}}
+		sim.Spec.Config.SeedStrategy = &strategy
+		return sim
+	}
+
+	master := int64(42)
+	sim := newSim(toolsv1.SeedStrategy{Type: toolsv1.RandomSeeds, Count: 5, MasterSeed: &master})
+	seeds, _, err := r.getSeeds(ctx, sim)
+	if err != nil || len(seeds) != 5 {
+		t.Fatalf("wanted 5 random seeds, got %v %v", seeds, err)
+	}
+	again, _ := getRandomSeeds(master, 5)
+	if !reflect.DeepEqual(seeds, again) || !reflect.DeepEqual(sim.Status.Seeds, seeds) {
+		t.Fatalf("wanted seeds to be reproducible from the master seed")
+	}
+
+	// Generated seeds are kept even if the strategy changes
+	sim.Spec.Config.SeedStrategy.Count = 10
+	if seeds, _, _ := r.getSeeds(ctx, sim); len(seeds) != 5 {
+		t.Fatalf("wanted recorded seeds, got %v", seeds)
+	}
+
+	// Master seeds are recorded when not set
+	sim = newSim(toolsv1.SeedStrategy{Type: toolsv1.RandomSeeds, Count: 3})
+	if _, _, err := r.getSeeds(ctx, sim); err != nil || sim.Status.MasterSeed == nil {
+		t.Fatalf("wanted master seed to be recorded, got %v", err)
+	}
+
+	sim = newSim(toolsv1.SeedStrategy{Type: toolsv1.RangeSeeds, Start: 10, End: 12})
+	if seeds, _, _ := r.getSeeds(ctx, sim); !reflect.DeepEqual(seeds, []string{"10", "11", "12"}) {
+		t.Fatalf("unexpected range seeds %v", seeds)
+	}
+
+	sim = newSim(toolsv1.SeedStrategy{Type: toolsv1.RangeSeeds, Start: 12, End: 10})
+	seeds, _, err = r.getSeeds(ctx, sim)
+	if c := getCondition(sim, toolsv1.SeedsGenerated); err != nil || seeds != nil || c == nil || c.Status != corev1.ConditionFalse {
+		t.Fatalf("wanted invalid range to be reported, got %v %v", seeds, err)
+	}
+
+	// Failed seeds are only taken once the previous simulation finished
+	sim = newSim(toolsv1.SeedStrategy{Type: toolsv1.PreviousFailuresSeeds, Simulation: "previous"})
+	seeds, after, err := r.getSeeds(ctx, sim)
+	if err != nil || seeds != nil || after != seedsRetryInterval {
+		t.Fatalf("wanted to wait for previous simulation, got %v %v %v", seeds, after, err)
+	}
+	if seedsResolved(sim) {
+		t.Fatalf("wanted seeds not to be resolved while waiting")
+	}
+
+	// Waiting simulations do not succeed without running any job
+	updateGlobalStatus(sim)
+	if sim.Status.Status == toolsv1.SimulationSucceed {
+		t.Fatalf("wanted waiting simulation not to succeed")
+	}
+
+	previous.Status.Status = toolsv1.SimulationFailed
+	if err := r.Update(ctx, previous); err != nil {
+		t.Fatal(err)
+	}
+	seeds, _, err = r.getSeeds(ctx, sim)
+	if err != nil || !reflect.DeepEqual(seeds, []string{"1", "3"}) {
+		t.Fatalf("wanted failed seeds, got %v %v", seeds, err)
+	}
+	if !seedsResolved(sim) {
+		t.Fatalf("wanted seeds to be resolved")
+	}
+
+	// Simulations succeed without jobs when there are no failed seeds
+	sim = newSim(toolsv1.SeedStrategy{Type: toolsv1.PreviousFailuresSeeds, Simulation: "succeeded"})
+	seeds, after, err = r.getSeeds(ctx, sim)
+	if err != nil || len(seeds) != 0 || after != 0 {
+		t.Fatalf("wanted no seeds, got %v %v %v", seeds, after, err)
+	}
+	if c := getCondition(sim, toolsv1.SeedsGenerated); c == nil || c.Status != corev1.ConditionFalse || c.Reason != noFailedSeedsReason {
+		t.Fatalf("wanted no failed seeds to be reported, got %+v", c)
+	}
+	updateGlobalStatus(sim)
+	if sim.Status.Status != toolsv1.SimulationSucceed {
+		t.Fatalf("wanted simulation to succeed, got %s", sim.Status.Status)
+	}
+}
@@ -4,62 +4,203 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
 
 	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
-	"github.com/allinbits/runsim-operator/internal/genesis"
 )
 
-func (r *SimulationReconciler) ReconcileSimulation(ctx context.Context, sim *toolsv1.Simulation) error {
+func (r *SimulationReconciler) ReconcileSimulation(ctx context.Context, sim *toolsv1.Simulation) (ctrl.Result, error) {
 	log := r.log.WithValues("simulations", sim.Name)
 
-	for _, seed := range sim.Spec.Config.Seeds {
-		// Get the job if it already exists
-		job, err := r.GetJob(ctx, sim, seed)
-		if err != nil {
-			return err
+	if r.opts.podArtifactsEnabled() {
+		if err := r.ensureArtifactsSecret(ctx, sim); err != nil {
+			return ctrl.Result{}, err
 		}
+	}
+
+	// Invalid simulations are reported instead of being run
+	if err := validateSimulation(sim, r.opts); err != nil {
+		setCondition(sim, toolsv1.SpecValid, corev1.ConditionFalse, invalidSpecReason, err.Error())
+		updateGlobalStatus(sim)
+		sim.Status.Status = toolsv1.SimulationFailed
+		return ctrl.Result{}, r.Status().Update(ctx, sim)
+	}
+	setCondition(sim, toolsv1.SpecValid, corev1.ConditionTrue, "Valid", "")
+
+	// Unfinished jobs are terminated once the simulation is cancelled or exceeds its deadline
+	termination, requeueAfter, err := getTerminationReason(sim)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	seeds, seedsAfter, err := r.getSeeds(ctx, sim)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	requeueAfter = minRequeue(requeueAfter, seedsAfter)
+
+	// Every seed is run for each cell of the matrix
+	cells := getMatrixCells(sim)
 
-		// Create the job if it does not exist
-		if job == nil {
-			log.Info("creating job", "seed", seed)
-			if job, err = r.CreateJob(ctx, sim, seed); err != nil {
-				return err
+	var finished []*batchv1.Job
+	for _, cell := range cells {
+		for _, seed := range seeds {
+			// Get the job if it already exists
+			job, err := r.GetJob(ctx, sim, cell.Name, seed)
+			if err != nil {
+				return ctrl.Result{}, err
 			}
-		}
 
-		if err := updateJobStatus(sim, job); err != nil {
-			return err
-		}
+			// Wait for jobs being deleted, e.g. to be run again, to be gone
+			status := getJobStatus(sim, getJobName(sim, cell.Name, seed))
+			if job != nil && (!job.DeletionTimestamp.IsZero() || isPreviousAttempt(status, job)) {
+				continue
+			}
 
-		if r.opts.LogBackupEnabled {
-			if err := r.backupJobLogs(ctx, sim, job); err != nil {
-				return err
+			// Jobs deleted after finishing are not created again
+			if job == nil && status != nil && status.JobDeleted {
+				continue
 			}
-		}
 
-		if job.Status.Succeeded > 0 || job.Status.Failed > 0 {
-			if err := r.removeSafeToEvictAnnotation(job); err != nil {
-				return err
+			// Seeds which did not start are not run after termination
+			if job == nil && termination != "" {
+				terminatedStatus := toolsv1.SimulationFailed
+				if termination == cancelledReason {
+					terminatedStatus = toolsv1.SimulationCancelled
+				}
+				if status == nil || !isJobFinished(status.Status) {
+					setJobStatus(sim, cell, seed, terminatedStatus)
+				}
+				continue
+			}
+
+			if sim.Spec.Suspend {
+				suspended, err := r.suspendJob(ctx, sim, cell, seed, job)
+				if err != nil {
+					return ctrl.Result{}, err
+				}
+				if suspended {
+					continue
+				}
+			}
+
+			// Create the job if it does not exist
+			if job == nil {
+				if r.waitForPreviousStage(sim, cell, seed) {
+					continue
+				}
+
+				// Start over if the seed was interrupted
+				if status != nil && status.Status == toolsv1.SimulationSuspended {
+					resetJobStatus(status)
+				}
+
+				log.Info("creating job", "cell", cell.Name, "seed", seed)
+				if job, err = r.CreateJob(ctx, sim, cell, seed); err != nil {
+					return ctrl.Result{}, err
+				}
+			}
+
+			if err := updateJobStatus(sim, cell, job); err != nil {
+				return ctrl.Result{}, err
+			}
+			updateJobTimes(sim, job)
+
+			pod, err := r.getJobPod(ctx, job)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			updateJobCommit(sim, job, pod)
+			updateJobResult(sim, job, pod)
+			updateJobResources(sim, job, pod)
+			updateJobFailure(sim, job, pod)
+			updateJobStages(sim, job, pod)
+
+			if r.opts.LogBackupEnabled {
+				if err := r.backupJobLogs(ctx, sim, job, pod); err != nil {
+					return ctrl.Result{}, err
+				}
+				if err := r.updateJobArtifacts(ctx, sim, job); err != nil {
+					return ctrl.Result{}, err
+				}
+			}
+			updateJobPhases(sim, job, pod, r.opts.LogBackupEnabled)
+
+			if job.Status.Succeeded > 0 || job.Status.Failed > 0 {
+				if err := r.removeSafeToEvictAnnotation(job); err != nil {
+					return ctrl.Result{}, err
+				}
+				finished = append(finished, job)
+				continue
+			}
+
+			reason, setupRemaining, err := getSetupTerminationReason(sim, pod)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			requeueAfter = minRequeue(requeueAfter, setupRemaining)
+			if stage := getStuckStage(sim, pod); stage != "" {
+				reason = stageKilledReason
+			}
+			if termination != "" {
+				reason = termination
+			}
+			if reason != "" {
+				if err := r.terminateJob(ctx, job, reason); err != nil {
+					return ctrl.Result{}, err
+				}
 			}
 		}
 	}
 
-	// Delete jobs removed from spec
-	for _, s := range sim.Status.JobStatus {
-		if !contains(sim.Spec.Config.Seeds, s.Seed) {
-			if err := r.MaybeDeleteJob(ctx, sim, s.Seed); err != nil {
-				return err
+	updateDeterminismStatus(sim)
+
+	// Delete finished jobs according to the retention policy
+	cleanupAfter, err := r.cleanupJobs(ctx, sim, finished)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	requeueAfter = minRequeue(requeueAfter, cleanupAfter)
+
+	// Delete jobs removed from spec, unless the seeds to run are not known
+	if seedsResolved(sim) {
+		for _, s := range sim.Status.JobStatus {
+			if !hasMatrixCell(sim, s.Cell) || !contains(seeds, s.Seed) {
+				if err := r.MaybeDeleteJob(ctx, sim, s.Cell, s.Seed); err != nil {
+					return ctrl.Result{}, err
+				}
+				removeJobFromStatus(sim, s.Name)
 			}
-			removeJobFromStatus(sim, s.Name)
 		}
 	}
 
 	log.Info("updating status")
 	updateGlobalStatus(sim)
-	if err := updateGenesisStatus(sim); err != nil {
-		return fmt.Errorf("could not retrieve information from genesis: %v", err)
+	updateSimulationTimes(sim, time.Now())
+	updateSuggestedResources(sim)
+	if err := r.updateGenesisStatus(ctx, sim); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	baselineAfter, err := r.updateBenchmarkComparison(ctx, sim)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	requeueAfter = minRequeue(requeueAfter, baselineAfter)
+
+	if r.opts.LogBackupEnabled {
+		updateLogBackupCondition(sim)
+		if err := r.updateManifest(ctx, sim); err != nil {
+			return ctrl.Result{}, err
+		}
 	}
-	return r.Status().Update(ctx, sim)
+	return ctrl.Result{RequeueAfter: requeueAfter}, r.Status().Update(ctx, sim)
 }
 
 func (r *SimulationReconciler) setSimulationDefaults(sim *toolsv1.Simulation) bool {
@@ -77,8 +218,11 @@ func (r *SimulationReconciler) setSimulationDefaults(sim *toolsv1.Simulation) bo
 		sim.Spec.Target.Package = DefaultPackage
 	}
 
-	if sim.Spec.Config.Test == "" {
-		sim.Spec.Config.Test = DefaultTest
+	if sim.Spec.Config.Mode == "" {
+		sim.Spec.Config.Mode = toolsv1.FullAppMode
+		if sim.Spec.Config.Benchmark {
+			sim.Spec.Config.Mode = toolsv1.BenchmarkMode
+		}
 	}
 
 	if sim.Spec.Config.Blocks == 0 {
@@ -97,7 +241,7 @@ func (r *SimulationReconciler) setSimulationDefaults(sim *toolsv1.Simulation) bo
 		sim.Spec.Config.Timeout = DefaultTimeout
 	}
 
-	if len(sim.Spec.Config.Seeds) == 0 {
+	if len(sim.Spec.Config.Seeds) == 0 && sim.Spec.Config.SeedStrategy == nil {
 		sim.Spec.Config.Seeds = DefaultSeeds
 	}
 
@@ -115,7 +259,8 @@ func (r *SimulationReconciler) setSimulationDefaults(sim *toolsv1.Simulation) bo
 }
 
 func updateGlobalStatus(sim *toolsv1.Simulation) {
-	var running, failed, succeeded, pending int
+	var running, failed, succeeded, pending, suspended, cancelled int
+	var appFailures, infrastructureFailures int
 
 	for _, job := range sim.Status.JobStatus {
 		switch job.Status {
@@ -123,10 +268,20 @@ func updateGlobalStatus(sim *toolsv1.Simulation) {
 			running += 1
 		case toolsv1.SimulationSucceed:
 			succeeded += 1
-		case toolsv1.SimulationFailed:
+		case toolsv1.SimulationFailed, toolsv1.SimulationNondeterministic:
 			failed += 1
+			switch job.FailureType {
+			case toolsv1.AppFailure:
+				appFailures += 1
+			case toolsv1.InfrastructureFailure:
+				infrastructureFailures += 1
+			}
 		case toolsv1.SimulationPending:
 			pending += 1
+		case toolsv1.SimulationSuspended:
+			suspended += 1
+		case toolsv1.SimulationCancelled:
+			cancelled += 1
 		}
 	}
 
@@ -134,32 +289,86 @@ func updateGlobalStatus(sim *toolsv1.Simulation) {
 	sim.Status.Failed = &failed
 	sim.Status.Running = &running
 	sim.Status.Pending = &pending
+	sim.Status.Suspended = &suspended
+	sim.Status.AppFailures = &appFailures
+	sim.Status.InfrastructureFailures = &infrastructureFailures
 
 	switch {
-	case succeeded == len(sim.Status.JobStatus):
+	case succeeded > 0 && succeeded == len(sim.Status.JobStatus):
 		sim.Status.Status = toolsv1.SimulationSucceed
+	case len(sim.Status.JobStatus) == 0 && noFailedSeeds(sim):
+		sim.Status.Status = toolsv1.SimulationSucceed
+	case cancelled > 0 && running == 0:
+		sim.Status.Status = toolsv1.SimulationCancelled
 	case failed > 0:
 		sim.Status.Status = toolsv1.SimulationFailed
+	case suspended > 0 && running == 0:
+		sim.Status.Status = toolsv1.SimulationSuspended
 	case pending == len(sim.Status.JobStatus):
 		sim.Status.Status = toolsv1.SimulationPending
 	default:
 		sim.Status.Status = toolsv1.SimulationRunning
 	}
 
+	// Failures of the app matter more than infrastructure problems
+	switch {
+	case appFailures > 0:
+		sim.Status.FailureType = toolsv1.AppFailure
+	case infrastructureFailures > 0:
+		sim.Status.FailureType = toolsv1.InfrastructureFailure
+	default:
+		sim.Status.FailureType = ""
+	}
 }
 
-func updateGenesisStatus(sim *toolsv1.Simulation) error {
-	if sim.Spec.Config.Genesis != nil && sim.Spec.Config.Genesis.FromURL != "" {
-		if sim.Status.Genesis == nil {
-			chainId, hash, err := genesis.GetChainIdAndHashFromRemote(sim.Spec.Config.Genesis.FromURL)
-			if err != nil {
-				return err
-			}
+func (r *SimulationReconciler) updateGenesisStatus(ctx context.Context, sim *toolsv1.Simulation) error {
+	switch {
+	case sim.Spec.Config.Genesis == nil:
+		return nil
+	case sim.Spec.Config.Genesis.FromURL != "" && sim.Status.Genesis == nil:
+		info, err := r.genesis.Lookup(sim)
+		switch {
+		case info != nil:
 			sim.Status.Genesis = &toolsv1.GenesisInfo{
-				ChainId: chainId,
-				Sha256:  hash,
+				ChainId:       info.ChainId,
+				Sha256:        info.Sha256,
+				PatchedSha256: info.PatchedSha256,
 			}
+			setCondition(sim, toolsv1.GenesisResolved, corev1.ConditionTrue, "Resolved", "")
+		case err != nil:
+			setCondition(sim, toolsv1.GenesisResolved, corev1.ConditionFalse, "ResolveFailed",
+				fmt.Sprintf("could not retrieve information from genesis: %v", err))
+		default:
+			setCondition(sim, toolsv1.GenesisResolved, corev1.ConditionUnknown, "Resolving", "")
+		}
+	case sim.Spec.Config.Genesis.FromURL != "":
+		setCondition(sim, toolsv1.GenesisResolved, corev1.ConditionTrue, "Resolved", "")
+	case sim.Spec.Config.Genesis.FromConfigMap != nil && sim.Status.Genesis == nil:
+		ref := sim.Spec.Config.Genesis.FromConfigMap
+		var cm corev1.ConfigMap
+		err := r.Get(ctx, types.NamespacedName{Namespace: sim.Namespace, Name: ref.Name}, &cm)
+		if errors.IsNotFound(err) {
+			setCondition(sim, toolsv1.GenesisResolved, corev1.ConditionFalse, "ConfigMapNotFound",
+				fmt.Sprintf("configmap %s not found", ref.Name))
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		info, err := r.genesis.LookupConfigMap(&cm, ref.Key, sim.Spec.Config.Genesis.Patches)
+		if err != nil {
+			setCondition(sim, toolsv1.GenesisResolved, corev1.ConditionFalse, "ResolveFailed",
+				fmt.Sprintf("could not read genesis: %v", err))
+			return nil
+		}
+		sim.Status.Genesis = &toolsv1.GenesisInfo{
+			ChainId:       info.ChainId,
+			Sha256:        info.Sha256,
+			PatchedSha256: info.PatchedSha256,
 		}
+		setCondition(sim, toolsv1.GenesisResolved, corev1.ConditionTrue, "FromConfigMap", "")
+	case sim.Spec.Config.Genesis.FromConfigMap != nil:
+		setCondition(sim, toolsv1.GenesisResolved, corev1.ConditionTrue, "FromConfigMap", "")
 	}
 	return nil
 }
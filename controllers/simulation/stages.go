@@ -0,0 +1,105 @@
+package simulation
+
+import (
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+	"github.com/allinbits/runsim-operator/internal/tools"
+)
+
+// Stages of simulations run across an upgrade.
+const (
+	exportStage  = "export"
+	upgradeStage = "upgrade"
+)
+
+// Reasons for which stages are skipped.
+const (
+	previousStageFailedReason = "PreviousStageFailed"
+	artifactsDisabledReason   = "ArtifactsDisabled"
+)
+
+// getUpgradeCells returns the cells running each cell before and after the
+// upgrade, the latter continuing from the state exported by the former.
+func getUpgradeCells(cells []matrixCell, upgrade *toolsv1.UpgradeSpec) []matrixCell {
+	staged := make([]matrixCell, 0, 2*len(cells))
+	for _, c := range cells {
+		export := c
+		export.Name = joinCellName(c.Name, exportStage)
+		export.stage = exportStage
+
+		upgraded := c
+		upgraded.Name = joinCellName(c.Name, upgradeStage)
+		upgraded.stage = upgradeStage
+		upgraded.previous = export.Name
+		upgraded.version = upgrade.Version
+		if _, ok := c.Parameters[versionParameter]; ok {
+			// The parameters are shared with the export, so they are copied
+			upgraded.Parameters = make(map[string]string, len(c.Parameters))
+			for k, v := range c.Parameters {
+				upgraded.Parameters[k] = v
+			}
+			upgraded.Parameters[versionParameter] = upgrade.Version
+		}
+		if upgrade.Blocks != 0 {
+			upgraded.blocks = upgrade.Blocks
+		}
+		upgraded.test = upgrade.Test
+		upgraded.upgradeName = upgrade.UpgradeName
+
+		staged = append(staged, export, upgraded)
+	}
+	return staged
+}
+
+// waitForPreviousStage returns whether the stage run by the cell cannot start
+// yet, as its previous stage did not succeed, recording why in its status.
+func (r *SimulationReconciler) waitForPreviousStage(sim *toolsv1.Simulation, cell matrixCell, seed string) bool {
+	if cell.previous == "" {
+		return false
+	}
+
+	reason := ""
+	previous := getJobStatus(sim, getJobName(sim, cell.previous, seed))
+	switch {
+	case previous == nil || !isJobFinished(previous.Status) && previous.Status != toolsv1.SimulationCancelled:
+		setJobStatus(sim, cell, seed, toolsv1.SimulationPending)
+	case previous.Status != toolsv1.SimulationSucceed:
+		reason = previousStageFailedReason
+	case !r.opts.podArtifactsEnabled():
+		// The state is passed on through the artifact store
+		reason = artifactsDisabledReason
+	default:
+		return false
+	}
+
+	if reason != "" {
+		setJobStatus(sim, cell, seed, toolsv1.SimulationSkipped)
+		getJobStatus(sim, getJobName(sim, cell.Name, seed)).Reason = reason
+	}
+	return true
+}
+
+// addDownloadStateContainer adds the init container writing the genesis the
+// stage run by the cell continues from, out of the state exported by the
+// previous stage.
+func addDownloadStateContainer(job *batchv1.Job, sim *toolsv1.Simulation, cell matrixCell, seed string) {
+	simContainer := job.Spec.Template.Spec.Containers[0]
+	container := corev1.Container{
+		Name:  downloadStateContainerName,
+		Image: simContainer.Image,
+		Command: []string{
+			toolsBinPath, tools.DownloadStateCommand,
+			"-key", getArtifactKey(sim, cell.previous, seed, artifactFile{name: stateArtifactName}),
+			"-out", stateGenesisPath,
+		},
+		EnvFrom: simContainer.EnvFrom,
+	}
+	for _, m := range simContainer.VolumeMounts {
+		if m.Name == "data" || m.Name == "tools" || m.Name == "artifacts" {
+			container.VolumeMounts = append(container.VolumeMounts, m)
+		}
+	}
+	job.Spec.Template.Spec.InitContainers = append(job.Spec.Template.Spec.InitContainers, container)
+}
@@ -0,0 +1,101 @@
+package simulation
+
+import (
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+	"github.com/allinbits/runsim-operator/internal/tools"
+)
+
+func TestUpgradeStages(t *testing.T) {
+	sim := &toolsv1.Simulation{ObjectMeta: metav1.ObjectMeta{Name: "sim", Namespace: "default"}}
+	sim.Spec.Target.Version = "v0.44.0"
+	sim.Spec.Config.Blocks = 100
+	sim.Spec.Config.Genesis = &toolsv1.GenesisSpec{FromURL: "https://example.com/genesis.json"}
+	sim.Spec.Upgrade = &toolsv1.UpgradeSpec{Version: "v0.45.0", Blocks: 50, UpgradeName: "v045"}
+
+	cells := getMatrixCells(sim)
+	if len(cells) != 2 || cells[0].Name != exportStage || cells[1].previous != exportStage {
+		t.Fatalf("unexpected cells %+v", cells)
+	}
+
+	opts := defaultOptions()
+	opts.LogBackupEnabled = true
+	r := &SimulationReconciler{opts: opts}
+
+	// The upgrade waits for the export to succeed
+	if !r.waitForPreviousStage(sim, cells[1], "1") {
+		t.Fatalf("wanted upgrade to wait for export")
+	}
+	setJobStatus(sim, cells[0], "1", toolsv1.SimulationFailed)
+	r.waitForPreviousStage(sim, cells[1], "1")
+	status := getJobStatus(sim, getJobName(sim, cells[1].Name, "1"))
+	if status.Status != toolsv1.SimulationSkipped || status.Reason != previousStageFailedReason || status.Stage != upgradeStage {
+		t.Fatalf("wanted upgrade to be skipped, got %+v", status)
+	}
+	setJobStatus(sim, cells[0], "1", toolsv1.SimulationSucceed)
+	if r.waitForPreviousStage(sim, cells[1], "1") {
+		t.Fatalf("wanted upgrade to run once export succeeded")
+	}
+
+	job, err := getJobSpec(sim, cells[1], "1", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := job.Spec.Template.Spec
+	if clone := spec.InitContainers[0].Command[2]; !strings.Contains(clone, "'v0.45.0'") {
+		t.Fatalf("wanted upgraded version to be cloned, got %s", clone)
+	}
+	download := spec.InitContainers[len(spec.InitContainers)-1]
+	if download.Command[1] != tools.DownloadStateCommand || download.Command[3] != "default/sim/export/1/state.json.gz" {
+		t.Fatalf("unexpected download container %v", download.Command)
+	}
+	cmd := spec.Containers[0].Args[2]
+	for _, flag := range []string{"-NumBlocks=50", "-Genesis=" + stateGenesisPath, "-UpgradeName='v045'"} {
+		if !strings.Contains(cmd, flag) {
+			t.Fatalf("wanted %s flag, got %s", flag, cmd)
+		}
+	}
+	for _, c := range spec.InitContainers {
+		if c.Name == "download-genesis" {
+			t.Fatalf("wanted the genesis of the simulation to be replaced by the exported state")
+		}
+	}
+
+	job, err = getJobSpec(sim, cells[0], "1", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd := job.Spec.Template.Spec.Containers[0].Args[2]; !strings.Contains(cmd, "-ExportStatePath") || !strings.Contains(cmd, "-NumBlocks=100") {
+		t.Fatalf("wanted export stage to export its state, got %s", cmd)
+	}
+}
+
+func TestUpgradeStagesParameters(t *testing.T) {
+	sim := &toolsv1.Simulation{ObjectMeta: metav1.ObjectMeta{Name: "sim", Namespace: "default"}}
+	sim.Spec.Matrix = &toolsv1.MatrixSpec{Versions: []string{"v0.44.0"}}
+	sim.Spec.Upgrade = &toolsv1.UpgradeSpec{Version: "v0.45.0"}
+
+	cells := getMatrixCells(sim)
+	if len(cells) != 2 {
+		t.Fatalf("unexpected cells %+v", cells)
+	}
+	if v := cells[0].Parameters[versionParameter]; v != "v0.44.0" {
+		t.Fatalf("wanted export to keep its version, got %s", v)
+	}
+	if v := cells[1].Parameters[versionParameter]; v != "v0.45.0" {
+		t.Fatalf("wanted upgrade to report the upgraded version, got %s", v)
+	}
+
+	// Upgrades continue from the exported state
+	if err := validateSimulation(sim, defaultOptions()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sim.Spec.Config.Mode = toolsv1.NondeterminismMode
+	if err := validateSimulation(sim, defaultOptions()); err == nil {
+		t.Fatalf("wanted upgrades of the nondeterminism mode to be rejected")
+	}
+}
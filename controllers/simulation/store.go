@@ -0,0 +1,80 @@
+package simulation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/allinbits/runsim-operator/internal/tools"
+)
+
+const (
+	S3ArtifactStore         = tools.S3Store
+	FilesystemArtifactStore = tools.FilesystemStore
+	MemoryArtifactStore     = "memory"
+)
+
+// ErrArtifactNotFound is returned when there is no object stored under a key.
+var ErrArtifactNotFound = errors.New("artifact not found")
+
+// ArtifactStore stores the artifacts produced by simulations, such as logs
+// and exported state, under keys of the form <simulation>/<seed>/<name>.
+type ArtifactStore interface {
+	// Put stores the contents read from r under key.
+	Put(ctx context.Context, key string, r io.Reader, opts PutOptions) error
+
+	// Get returns a reader for the object stored under key, or
+	// ErrArtifactNotFound if there is none.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+
+	// Stat returns information about the object stored under key, or
+	// ErrArtifactNotFound if there is none.
+	Stat(ctx context.Context, key string) (*ArtifactInfo, error)
+
+	// Delete removes the object stored under key, if any.
+	Delete(ctx context.Context, key string) error
+
+	// List returns information about every object stored under prefix.
+	// Metadata is not included.
+	List(ctx context.Context, prefix string) ([]ArtifactInfo, error)
+
+	// ListPrefixes returns the prefixes directly under prefix, which is empty
+	// or ends with a slash, without listing the objects stored under them.
+	// Prefixes end with a slash.
+	ListPrefixes(ctx context.Context, prefix string) ([]string, error)
+
+	// URL returns the URL of the object stored under key.
+	URL(key string) string
+}
+
+// PutOptions specifies how an object is stored.
+type PutOptions struct {
+	ContentType     string
+	ContentEncoding string
+
+	// Metadata is stored along with the object. Keys are lower case.
+	Metadata map[string]string
+}
+
+// ArtifactInfo holds information about a stored object.
+type ArtifactInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+	Metadata     map[string]string
+}
+
+func newArtifactStore(opts *Options) (ArtifactStore, error) {
+	switch opts.ArtifactStore {
+	case S3ArtifactStore:
+		return newS3Store(opts.s3Config())
+	case FilesystemArtifactStore:
+		return newFilesystemStore(opts.ArtifactsDir)
+	case MemoryArtifactStore:
+		return newMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown artifact store %q", opts.ArtifactStore)
+	}
+}
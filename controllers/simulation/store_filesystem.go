@@ -0,0 +1,124 @@
+package simulation
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/allinbits/runsim-operator/internal/tools"
+)
+
+// filesystemStore stores artifacts in a directory, e.g. a mounted PVC.
+type filesystemStore struct {
+	dir string
+}
+
+func newFilesystemStore(dir string) (*filesystemStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &filesystemStore{dir: dir}, nil
+}
+
+func (s *filesystemStore) Put(_ context.Context, key string, r io.Reader, opts PutOptions) error {
+	return tools.WriteFileObject(s.path(key), r, opts.Metadata)
+}
+
+func (s *filesystemStore) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	f, err := os.Open(s.path(key))
+	if os.IsNotExist(err) {
+		return nil, ErrArtifactNotFound
+	}
+	return f, err
+}
+
+func (s *filesystemStore) Stat(_ context.Context, key string) (*ArtifactInfo, error) {
+	fi, err := os.Stat(s.path(key))
+	if os.IsNotExist(err) {
+		return nil, ErrArtifactNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	info := &ArtifactInfo{Key: key, Size: fi.Size(), LastModified: fi.ModTime()}
+	b, err := ioutil.ReadFile(tools.MetadataPath(s.path(key)))
+	if os.IsNotExist(err) {
+		return info, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &info.Metadata); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (s *filesystemStore) Delete(_ context.Context, key string) error {
+	for _, p := range []string{s.path(key), tools.MetadataPath(s.path(key))} {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *filesystemStore) List(_ context.Context, prefix string) ([]ArtifactInfo, error) {
+	// Only walk the directory holding the prefix
+	root := s.path(path.Dir(prefix))
+	if _, err := os.Stat(root); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	var objects []ArtifactInfo
+	err := filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Skip metadata and temporary files
+		if fi.IsDir() || strings.HasPrefix(fi.Name(), ".") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.dir, p)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			objects = append(objects, ArtifactInfo{Key: key, Size: fi.Size(), LastModified: fi.ModTime()})
+		}
+		return nil
+	})
+	return objects, err
+}
+
+func (s *filesystemStore) ListPrefixes(_ context.Context, prefix string) ([]string, error) {
+	infos, err := ioutil.ReadDir(s.path(prefix))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var prefixes []string
+	for _, fi := range infos {
+		if fi.IsDir() && !strings.HasPrefix(fi.Name(), ".") {
+			prefixes = append(prefixes, prefix+fi.Name()+"/")
+		}
+	}
+	return prefixes, nil
+}
+
+func (s *filesystemStore) URL(key string) string {
+	return "file://" + s.path(key)
+}
+
+// path returns the path for key, which is never outside of the store directory.
+func (s *filesystemStore) path(key string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(path.Clean("/"+key)))
+}
@@ -0,0 +1,111 @@
+package simulation
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryStore keeps artifacts in memory. Artifacts are lost when the operator
+// restarts, so it is only meant for development and tests.
+type memoryStore struct {
+	mu      sync.RWMutex
+	objects map[string]memoryObject
+}
+
+type memoryObject struct {
+	data    []byte
+	opts    PutOptions
+	modTime time.Time
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{objects: make(map[string]memoryObject)}
+}
+
+func (s *memoryStore) Put(_ context.Context, key string, r io.Reader, opts PutOptions) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = memoryObject{data: data, opts: opts, modTime: time.Now()}
+	return nil
+}
+
+func (s *memoryStore) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	obj, ok := s.objects[key]
+	if !ok {
+		return nil, ErrArtifactNotFound
+	}
+	return ioutil.NopCloser(bytes.NewReader(obj.data)), nil
+}
+
+func (s *memoryStore) Stat(_ context.Context, key string) (*ArtifactInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	obj, ok := s.objects[key]
+	if !ok {
+		return nil, ErrArtifactNotFound
+	}
+	return &ArtifactInfo{Key: key, Size: int64(len(obj.data)), LastModified: obj.modTime, Metadata: obj.opts.Metadata}, nil
+}
+
+func (s *memoryStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, key)
+	return nil
+}
+
+func (s *memoryStore) List(_ context.Context, prefix string) ([]ArtifactInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var objects []ArtifactInfo
+	for key, obj := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, ArtifactInfo{Key: key, Size: int64(len(obj.data)), LastModified: obj.modTime})
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+func (s *memoryStore) ListPrefixes(_ context.Context, prefix string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var prefixes []string
+	for key := range s.objects {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		i := strings.Index(key[len(prefix):], "/")
+		if i < 0 {
+			continue
+		}
+		if p := key[:len(prefix)+i+1]; !seen[p] {
+			seen[p] = true
+			prefixes = append(prefixes, p)
+		}
+	}
+	sort.Strings(prefixes)
+	return prefixes, nil
+}
+
+func (s *memoryStore) URL(key string) string {
+	return "memory://" + key
+}
@@ -0,0 +1,93 @@
+package simulation
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+
+	"github.com/allinbits/runsim-operator/internal/s3"
+)
+
+// s3Store stores artifacts in a S3 compatible bucket, e.g. AWS S3, MinIO or GCS.
+type s3Store struct {
+	client *minio.Client
+	bucket string
+}
+
+func newS3Store(cfg s3.Config) (*s3Store, error) {
+	client, err := s3.NewClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &s3Store{client: client, bucket: cfg.Bucket}, nil
+}
+
+func (s *s3Store) Put(ctx context.Context, key string, r io.Reader, opts PutOptions) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, r, -1, minio.PutObjectOptions{
+		ContentType:     opts.ContentType,
+		ContentEncoding: opts.ContentEncoding,
+		UserMetadata:    opts.Metadata,
+	})
+	return err
+}
+
+func (s *s3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	// Stat first, as GetObject only fails once the object is read
+	if _, err := s.Stat(ctx, key); err != nil {
+		return nil, err
+	}
+	return s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+}
+
+func (s *s3Store) Stat(ctx context.Context, key string) (*ArtifactInfo, error) {
+	info, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ErrArtifactNotFound
+		}
+		return nil, err
+	}
+
+	// Metadata keys are returned in canonical header form
+	metadata := make(map[string]string, len(info.UserMetadata))
+	for k, v := range info.UserMetadata {
+		metadata[strings.ToLower(k)] = v
+	}
+	return &ArtifactInfo{Key: key, Size: info.Size, LastModified: info.LastModified, Metadata: metadata}, nil
+}
+
+func (s *s3Store) Delete(ctx context.Context, key string) error {
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (s *s3Store) List(ctx context.Context, prefix string) ([]ArtifactInfo, error) {
+	var objects []ArtifactInfo
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		objects = append(objects, ArtifactInfo{Key: obj.Key, Size: obj.Size, LastModified: obj.LastModified})
+	}
+	return objects, nil
+}
+
+func (s *s3Store) ListPrefixes(ctx context.Context, prefix string) ([]string, error) {
+	var prefixes []string
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		// Objects directly under prefix are returned as well
+		if strings.HasSuffix(obj.Key, "/") {
+			prefixes = append(prefixes, obj.Key)
+		}
+	}
+	return prefixes, nil
+}
+
+func (s *s3Store) URL(key string) string {
+	return fmt.Sprintf("%s/%s/%s", s.client.EndpointURL(), s.bucket, key)
+}
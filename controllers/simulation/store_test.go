@@ -0,0 +1,100 @@
+package simulation
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestArtifactStores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "artifacts")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fsStore, err := newFilesystemStore(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for name, store := range map[string]ArtifactStore{
+		FilesystemArtifactStore: fsStore,
+		MemoryArtifactStore:     newMemoryStore(),
+	} {
+		ctx := context.Background()
+
+		if _, err := store.Stat(ctx, "sim/1/simulation.log"); err != ErrArtifactNotFound {
+			t.Fatalf("%s: wanted ErrArtifactNotFound, got %v", name, err)
+		}
+
+		if err := store.Put(ctx, "sim/1/simulation.log", strings.NewReader("logs"), PutOptions{
+			ContentType: "text/plain",
+			Metadata:    map[string]string{"chunks": "1"},
+		}); err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+
+		info, err := store.Stat(ctx, "sim/1/simulation.log")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+
+		if info.Size != 4 {
+			t.Fatalf("%s: wanted size 4, got %d", name, info.Size)
+		}
+
+		if info.Metadata["chunks"] != "1" {
+			t.Fatalf("%s: wanted metadata, got %v", name, info.Metadata)
+		}
+
+		rc, err := store.Get(ctx, "sim/1/simulation.log")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		data, err := ioutil.ReadAll(rc)
+		_ = rc.Close()
+		if err != nil || string(data) != "logs" {
+			t.Fatalf("%s: wanted logs, got %q (%v)", name, data, err)
+		}
+
+		objects, err := store.List(ctx, "sim/")
+		if err != nil || len(objects) != 1 || objects[0].Key != "sim/1/simulation.log" {
+			t.Fatalf("%s: wanted one object, got %+v (%v)", name, objects, err)
+		}
+
+		prefixes, err := store.ListPrefixes(ctx, "")
+		if err != nil || len(prefixes) != 1 || prefixes[0] != "sim/" {
+			t.Fatalf("%s: wanted one prefix, got %v (%v)", name, prefixes, err)
+		}
+
+		prefixes, err = store.ListPrefixes(ctx, "sim/")
+		if err != nil || len(prefixes) != 1 || prefixes[0] != "sim/1/" {
+			t.Fatalf("%s: wanted one prefix, got %v (%v)", name, prefixes, err)
+		}
+
+		if !strings.HasSuffix(store.URL("sim/1/simulation.log"), "sim/1/simulation.log") {
+			t.Fatalf("%s: unexpected url %q", name, store.URL("sim/1/simulation.log"))
+		}
+
+		if err := store.Delete(ctx, "sim/1/simulation.log"); err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+
+		if _, err := store.Get(ctx, "sim/1/simulation.log"); err != ErrArtifactNotFound {
+			t.Fatalf("%s: wanted ErrArtifactNotFound, got %v", name, err)
+		}
+	}
+
+	// Keys are never written outside of the store directory
+	if err := fsStore.Put(context.Background(), "../escape", strings.NewReader("x"), PutOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "escape")); err != nil {
+		t.Fatalf("wanted object inside store directory: %v", err)
+	}
+}
@@ -0,0 +1,33 @@
+package simulation
+
+import (
+	"context"
+
+	batchv1 "k8s.io/api/batch/v1"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+)
+
+// suspendJob marks the seed as suspended if its job was not created yet or,
+// when running jobs are deleted on suspension, if its job did not finish.
+// It returns whether the seed was suspended.
+func (r *SimulationReconciler) suspendJob(ctx context.Context, sim *toolsv1.Simulation, cell matrixCell, seed string, job *batchv1.Job) (bool, error) {
+	if job != nil {
+		if job.Status.Succeeded > 0 || job.Status.Failed > 0 || !sim.Spec.DeleteRunningOnSuspend {
+			return false, nil
+		}
+
+		r.log.WithValues("simulation", sim.Name).Info("deleting job of suspended simulation", "seed", seed)
+		if err := r.MaybeDeleteJob(ctx, sim, cell.Name, seed); err != nil {
+			return false, err
+		}
+	}
+
+	// Seeds which finished are not interrupted
+	if status := getJobStatus(sim, getJobName(sim, cell.Name, seed)); status != nil && isJobFinished(status.Status) {
+		return job == nil, nil
+	}
+
+	setJobStatus(sim, cell, seed, toolsv1.SimulationSuspended)
+	return true, nil
+}
@@ -0,0 +1,77 @@
+package simulation
+
+import (
+	"context"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+)
+
+func TestSuspendJob(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	sim := &toolsv1.Simulation{ObjectMeta: metav1.ObjectMeta{Name: "sim", Namespace: "default", UID: "sim"}}
+	sim.Spec.Suspend = true
+	sim.Spec.DeleteRunningOnSuspend = true
+
+	owner := []metav1.OwnerReference{*metav1.NewControllerRef(sim, toolsv1.GroupVersion.WithKind("Simulation"))}
+	running := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: getJobName(sim, "", "1"), Namespace: sim.Namespace, OwnerReferences: owner}}
+	running.Status.Active = 1
+	finished := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: getJobName(sim, "", "2"), Namespace: sim.Namespace, OwnerReferences: owner}}
+	finished.Status.Succeeded = 1
+	sim.Status.JobStatus = []toolsv1.JobStatus{
+		{Name: running.Name, Seed: "1", Status: toolsv1.SimulationRunning, Commit: "abc"},
+		{Name: finished.Name, Seed: "2", Status: toolsv1.SimulationSucceed},
+	}
+
+	r := &SimulationReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme, running, finished),
+		log:    zap.New(),
+		opts:   &Options{},
+	}
+
+	for seed, job := range map[string]*batchv1.Job{"1": running, "2": finished, "3": nil} {
+		suspended, err := r.suspendJob(ctx, sim, matrixCell{}, seed, job)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if suspended != (seed != "2") {
+			t.Fatalf("unexpected suspension of seed %s: %v", seed, suspended)
+		}
+	}
+
+	err := r.Get(ctx, types.NamespacedName{Namespace: sim.Namespace, Name: running.Name}, &batchv1.Job{})
+	if !errors.IsNotFound(err) {
+		t.Fatalf("wanted running job to be deleted, got %v", err)
+	}
+
+	updateGlobalStatus(sim)
+	if sim.Status.Status != toolsv1.SimulationSuspended || *sim.Status.Suspended != 2 {
+		t.Fatalf("wanted suspended simulation, got %+v", sim.Status)
+	}
+
+	// Failures are not hidden by the suspension
+	getJobStatus(sim, finished.Name).Status = toolsv1.SimulationFailed
+	updateGlobalStatus(sim)
+	if sim.Status.Status != toolsv1.SimulationFailed {
+		t.Fatalf("wanted failed simulation, got %s", sim.Status.Status)
+	}
+
+	// Interrupted seeds start over when resumed
+	status := getJobStatus(sim, running.Name)
+	resetJobStatus(status)
+	if status.Commit != "" || status.Seed != "1" {
+		t.Fatalf("unexpected status after reset %+v", status)
+	}
+}
@@ -0,0 +1,91 @@
+package simulation
+
+import (
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+)
+
+// etaThreshold is how much the estimated completion of a simulation must move
+// for it to be updated. Every update of the status triggers a reconciliation,
+// so an estimate changing every second would have the simulation reconciled
+// continuously.
+const etaThreshold = time.Minute
+
+// updateJobTimes records when the job started and finished.
+func updateJobTimes(sim *toolsv1.Simulation, job *batchv1.Job) {
+	status := getJobStatus(sim, job.Name)
+	if status == nil {
+		return
+	}
+
+	if status.StartTime == nil && job.Status.StartTime != nil {
+		status.StartTime = job.Status.StartTime.DeepCopy()
+	}
+
+	if status.CompletionTime == nil && (job.Status.Succeeded > 0 || job.Status.Failed > 0) {
+		t := getJobCompletionTime(job)
+		status.CompletionTime = &t
+		if status.StartTime != nil {
+			status.Duration = &metav1.Duration{Duration: t.Sub(status.StartTime.Time)}
+		}
+	}
+}
+
+// updateSimulationTimes reports when the simulation started and, once every
+// job finished, when it completed. Until then, its completion is estimated
+// from the rate at which its jobs finished so far.
+func updateSimulationTimes(sim *toolsv1.Simulation, now time.Time) {
+	var (
+		start, end           *metav1.Time
+		finished, unfinished int
+		previous             = sim.Status.EstimatedCompletionTime
+	)
+	for _, s := range sim.Status.JobStatus {
+		if s.StartTime != nil && (start == nil || s.StartTime.Before(start)) {
+			start = s.StartTime
+		}
+		if !isJobFinished(s.Status) && s.Status != toolsv1.SimulationCancelled {
+			unfinished++
+			continue
+		}
+		finished++
+		if s.CompletionTime != nil && (end == nil || end.Before(s.CompletionTime)) {
+			end = s.CompletionTime
+		}
+	}
+
+	sim.Status.StartTime = start.DeepCopy()
+	sim.Status.CompletionTime = nil
+	sim.Status.Duration = nil
+	sim.Status.EstimatedCompletionTime = nil
+	if start == nil || finished == 0 {
+		return
+	}
+
+	if unfinished == 0 {
+		if end == nil {
+			end = &metav1.Time{Time: now}
+		}
+		sim.Status.CompletionTime = end.DeepCopy()
+		sim.Status.Duration = &metav1.Duration{Duration: end.Sub(start.Time)}
+		return
+	}
+
+	// Suspended simulations are not expected to complete
+	if sim.Status.Status == toolsv1.SimulationSuspended {
+		return
+	}
+	elapsed := now.Sub(start.Time)
+	remaining := time.Duration(int64(elapsed) / int64(finished) * int64(unfinished))
+	eta := metav1.NewTime(now.Add(remaining).Truncate(time.Second))
+	if previous != nil {
+		if moved := eta.Sub(previous.Time); moved < etaThreshold && moved > -etaThreshold {
+			eta = *previous
+		}
+	}
+	sim.Status.EstimatedCompletionTime = &eta
+}
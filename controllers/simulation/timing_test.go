@@ -0,0 +1,74 @@
+package simulation
+
+import (
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+)
+
+func TestUpdateTimes(t *testing.T) {
+	at := func(minutes int) metav1.Time {
+		return metav1.NewTime(time.Date(2020, 1, 1, 0, minutes, 0, 0, time.UTC))
+	}
+
+	sim := &toolsv1.Simulation{ObjectMeta: metav1.ObjectMeta{Name: "sim"}}
+	for _, seed := range []string{"1", "2", "3"} {
+		setJobStatus(sim, matrixCell{}, seed, toolsv1.SimulationRunning)
+	}
+	job := func(seed string, start, end int) *batchv1.Job {
+		started := at(start)
+		job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: getJobName(sim, "", seed)}}
+		job.Status.StartTime = &started
+		if end > 0 {
+			completed := at(end)
+			job.Status.CompletionTime = &completed
+			job.Status.Succeeded = 1
+		}
+		return job
+	}
+
+	// No seed finished yet
+	updateJobTimes(sim, job("1", 0, 0))
+	updateSimulationTimes(sim, at(10).Time)
+	if s := sim.Status; s.StartTime == nil || s.StartTime.Time != at(0).Time || s.EstimatedCompletionTime != nil {
+		t.Fatalf("unexpected times %+v", s)
+	}
+
+	// One of three seeds finished in 10 minutes
+	updateJobTimes(sim, job("1", 0, 10))
+	updateJobTimes(sim, job("2", 1, 0))
+	setJobStatus(sim, matrixCell{}, "1", toolsv1.SimulationSucceed)
+	updateSimulationTimes(sim, at(10).Time)
+	if d := getJobStatus(sim, getJobName(sim, "", "1")).Duration; d == nil || d.Duration != 10*time.Minute {
+		t.Fatalf("unexpected job duration %v", d)
+	}
+	if eta := sim.Status.EstimatedCompletionTime; eta == nil || eta.Time != at(30).Time {
+		t.Fatalf("unexpected estimated completion %v", eta)
+	}
+
+	// The estimate is kept until it moves significantly
+	updateSimulationTimes(sim, at(10).Add(10*time.Second))
+	if eta := sim.Status.EstimatedCompletionTime; eta == nil || eta.Time != at(30).Time {
+		t.Fatalf("wanted estimated completion to be kept, got %v", eta)
+	}
+	updateSimulationTimes(sim, at(11).Time)
+	if eta := sim.Status.EstimatedCompletionTime; eta == nil || eta.Time != at(33).Time {
+		t.Fatalf("wanted estimated completion to be updated, got %v", eta)
+	}
+
+	// Every seed finished
+	updateJobTimes(sim, job("2", 1, 15))
+	updateJobTimes(sim, job("3", 2, 20))
+	for _, seed := range []string{"2", "3"} {
+		setJobStatus(sim, matrixCell{}, seed, toolsv1.SimulationSucceed)
+	}
+	updateSimulationTimes(sim, at(21).Time)
+	s := sim.Status
+	if s.CompletionTime == nil || s.CompletionTime.Time != at(20).Time || s.Duration.Duration != 20*time.Minute || s.EstimatedCompletionTime != nil {
+		t.Fatalf("unexpected times %+v", s)
+	}
+}
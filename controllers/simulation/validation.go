@@ -0,0 +1,47 @@
+package simulation
+
+import (
+	"fmt"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+)
+
+// Reason of the SpecValid condition of invalid simulations.
+const invalidSpecReason = "InvalidSpec"
+
+// validateSimulation returns why the simulation cannot run, checking what
+// the schema of the resource cannot express.
+func validateSimulation(sim *toolsv1.Simulation, opts *Options) error {
+	seen := make(map[string]bool)
+	for _, c := range getMatrixCells(sim) {
+		if seen[c.Name] {
+			return fmt.Errorf("matrix cell %s is duplicated", c.Name)
+		}
+		seen[c.Name] = true
+	}
+
+	for _, s := range sim.Spec.Pipeline {
+		if s.Name == simulateStage && (s.Image != "" || len(s.Command) != 0) {
+			return fmt.Errorf("stage %s runs the simulation and takes no image nor command", simulateStage)
+		}
+		if s.Name != simulateStage && len(s.Command) == 0 {
+			return fmt.Errorf("stage %s requires a command", s.Name)
+		}
+	}
+
+	// Profiles are uploaded by the simulation pods
+	if len(getProfiles(sim)) > 0 && !opts.podArtifactsEnabled() {
+		return fmt.Errorf("profiles are enabled but simulation pods cannot upload artifacts")
+	}
+
+	// Replicas are compared through the state they export
+	if d := sim.Spec.Config.Determinism; d != nil && d.Replicas > 1 && !getSimulationMode(sim).exports {
+		return fmt.Errorf("mode %s does not export the state compared across replicas", sim.Spec.Config.Mode)
+	}
+
+	// The upgrade continues from the state exported before it
+	if sim.Spec.Upgrade != nil && !getSimulationMode(sim).exports {
+		return fmt.Errorf("mode %s does not export the state continued from after the upgrade", sim.Spec.Config.Mode)
+	}
+	return nil
+}
@@ -3,10 +3,12 @@ module github.com/allinbits/runsim-operator
 go 1.13
 
 require (
+	github.com/evanphx/json-patch v4.5.0+incompatible
 	github.com/go-logr/logr v0.1.0
 	github.com/minio/minio-go/v7 v7.0.5
 	github.com/onsi/ginkgo v1.11.0
 	github.com/onsi/gomega v1.8.1
+	golang.org/x/perf v0.0.0-20220411212318-84e58bfe0a7e
 	k8s.io/api v0.17.2
 	k8s.io/apimachinery v0.17.2
 	k8s.io/client-go v0.17.2
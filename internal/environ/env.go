@@ -32,3 +32,13 @@ func GetUint64(key string, fallback uint64) uint64 {
 
 	return fallback
 }
+
+func GetBool(key string, fallback bool) bool {
+	if value, ok := os.LookupEnv(key); ok {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+
+	return fallback
+}
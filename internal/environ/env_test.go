@@ -20,6 +20,10 @@ func TestEnviron(t *testing.T) {
 		t.Fatalf("wrong initialization")
 	}
 
+	if os.Getenv("boolean") != "" {
+		t.Fatalf("wrong initialization")
+	}
+
 	if environ.GetInt("integer", -1) != -1 {
 		t.Fatalf("wanted -1")
 	}
@@ -32,7 +36,11 @@ func TestEnviron(t *testing.T) {
 		t.Fatalf("wanted example")
 	}
 
-	integer, unsigned, str := "-1", "10", "example"
+	if environ.GetBool("boolean", true) != true {
+		t.Fatalf("wanted true")
+	}
+
+	integer, unsigned, str, boolean := "-1", "10", "example", "false"
 
 	if err := os.Setenv("integer", integer); err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -46,6 +54,10 @@ func TestEnviron(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
+	if err := os.Setenv("boolean", boolean); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
 	if environ.GetInt("integer", -5) != -1 {
 		t.Fatalf("wanted -1")
 	}
@@ -57,4 +69,8 @@ func TestEnviron(t *testing.T) {
 	if environ.GetString("string", "invalid") != "example" {
 		t.Fatalf("wanted example")
 	}
+
+	if environ.GetBool("boolean", true) != false {
+		t.Fatalf("wanted false")
+	}
 }
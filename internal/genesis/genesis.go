@@ -1,28 +1,115 @@
 package genesis
 
 import (
+	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"time"
 
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
 	iio "github.com/allinbits/runsim-operator/internal/io"
 )
 
-func GetChainIdAndHashFromRemote(url string) (string, string, error) {
-	client := http.Client{Timeout: time.Minute}
-	r, err := client.Get(url)
+// fetchTimeout bounds the time taken to download a whole genesis, which for
+// exports of live networks can be several hundred megabytes.
+const fetchTimeout = 15 * time.Minute
+
+// Info holds the information gathered from a genesis file.
+type Info struct {
+	ChainId       string
+	Sha256        string
+	PatchedSha256 string
+
+	// ETag and LastModified identify the version of the remote genesis
+	// the information was gathered from.
+	ETag         string
+	LastModified string
+}
+
+// GetInfoFromRemote downloads the genesis from url and returns its chain-id and
+// sha256. When patches are provided, the sha256 of the patched genesis is also returned.
+// If cached is provided the request is made conditional and cached is returned
+// when the remote genesis did not change.
+func GetInfoFromRemote(ctx context.Context, url string, patches []toolsv1.GenesisPatch, cached *Info) (*Info, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
-		return "", "", err
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	client := http.Client{Timeout: fetchTimeout}
+	r, err := client.Do(req)
+	if err != nil {
+		return nil, err
 	}
 	defer r.Body.Close()
 
+	if r.StatusCode == http.StatusNotModified && cached != nil {
+		return cached, nil
+	}
+
+	if r.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status downloading genesis: %s", r.Status)
+	}
+
+	info, err := GetInfo(r.Body, patches)
+	if err != nil {
+		return nil, err
+	}
+	info.ETag = r.Header.Get("ETag")
+	info.LastModified = r.Header.Get("Last-Modified")
+	return info, nil
+}
+
+// GetInfo reads a genesis from r and returns its chain-id and sha256. When
+// patches are provided, the sha256 of the patched genesis is also returned,
+// and the chain-id is the one of the patched genesis, which patches may set.
+func GetInfo(r io.Reader, patches []toolsv1.GenesisPatch) (*Info, error) {
+	info := &Info{}
+	var err error
+	if len(patches) == 0 {
+		if info.ChainId, info.Sha256, err = GetChainIdAndHash(r); err != nil {
+			return nil, err
+		}
+		return info, nil
+	}
+
+	// Patches require the whole document in memory
+	doc, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	info.Sha256 = fmt.Sprintf("%x", sha256.Sum256(doc))
+	patched, err := ApplyPatches(doc, patches)
+	if err != nil {
+		return nil, err
+	}
+	if info.ChainId, info.PatchedSha256, err = GetChainIdAndHash(bytes.NewReader(patched)); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// GetChainIdAndHash reads a genesis from r and returns its chain-id and sha256.
+func GetChainIdAndHash(r io.Reader) (string, string, error) {
 	pr, pw := io.Pipe()
 	defer pw.Close()
 
-	tee := iio.TeeReader(r.Body, pw)
+	tee := iio.TeeReader(r, pw)
 
 	outCh := make(chan string, 1)
 	errCh := make(chan error, 1)
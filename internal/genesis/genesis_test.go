@@ -0,0 +1,52 @@
+package genesis_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+	"github.com/allinbits/runsim-operator/internal/genesis"
+)
+
+func TestGetInfoFromRemote(t *testing.T) {
+	var downloads int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads++
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte(testGenesis))
+	}))
+	defer srv.Close()
+
+	patches := []toolsv1.GenesisPatch{{Type: toolsv1.SetChainId, Value: "simulation-1"}}
+	info, err := genesis.GetInfoFromRemote(context.Background(), srv.URL, patches, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if info.ChainId != "simulation-1" {
+		t.Fatalf("wanted patched chain_id simulation-1, got %q", info.ChainId)
+	}
+
+	if info.Sha256 == "" || info.PatchedSha256 == "" || info.Sha256 == info.PatchedSha256 {
+		t.Fatalf("wanted different original and patched hashes, got %q and %q", info.Sha256, info.PatchedSha256)
+	}
+
+	if info.ETag != `"v1"` {
+		t.Fatalf("wanted etag \"v1\", got %q", info.ETag)
+	}
+
+	cached, err := genesis.GetInfoFromRemote(context.Background(), srv.URL, patches, info)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cached != info || downloads != 1 {
+		t.Fatalf("wanted cached info to be reused, got %d downloads", downloads)
+	}
+}
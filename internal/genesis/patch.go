@@ -0,0 +1,130 @@
+package genesis
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+)
+
+// ApplyPatches applies patches, in order, to the genesis document.
+func ApplyPatches(doc []byte, patches []toolsv1.GenesisPatch) ([]byte, error) {
+	var err error
+	for i, p := range patches {
+		switch p.Type {
+		case toolsv1.JSONPatch:
+			var patch jsonpatch.Patch
+			if patch, err = jsonpatch.DecodePatch([]byte(p.Patch)); err == nil {
+				doc, err = patch.Apply(doc)
+			}
+		case toolsv1.MergePatch:
+			doc, err = jsonpatch.MergePatch(doc, []byte(p.Patch))
+		case toolsv1.SetChainId:
+			doc, err = transform(doc, func(g map[string]interface{}) error {
+				return setChainId(g, p.Value)
+			})
+		case toolsv1.ScaleVotingPower:
+			doc, err = transform(doc, func(g map[string]interface{}) error {
+				return scaleVotingPower(g, p.Value)
+			})
+		case toolsv1.SetUnbondingTime:
+			doc, err = transform(doc, func(g map[string]interface{}) error {
+				return setUnbondingTime(g, p.Value)
+			})
+		default:
+			err = fmt.Errorf("unknown patch type %q", p.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error applying patch %d (%s): %v", i, p.Type, err)
+		}
+	}
+	return doc, nil
+}
+
+func transform(doc []byte, fn func(map[string]interface{}) error) ([]byte, error) {
+	var g map[string]interface{}
+
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+	if err := dec.Decode(&g); err != nil {
+		return nil, err
+	}
+
+	if err := fn(g); err != nil {
+		return nil, err
+	}
+	return json.Marshal(g)
+}
+
+func setChainId(g map[string]interface{}, chainId string) error {
+	if chainId == "" {
+		return fmt.Errorf("chain_id cannot be empty")
+	}
+	g["chain_id"] = chainId
+	return nil
+}
+
+func scaleVotingPower(g map[string]interface{}, value string) error {
+	factor, ok := new(big.Rat).SetString(value)
+	if !ok || factor.Sign() <= 0 {
+		return fmt.Errorf("invalid factor %q", value)
+	}
+
+	validators, ok := g["validators"].([]interface{})
+	if !ok {
+		return fmt.Errorf("validators not found")
+	}
+
+	for _, v := range validators {
+		val, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("invalid validator type: %T", v)
+		}
+
+		power, ok := new(big.Rat).SetString(fmt.Sprint(val["power"]))
+		if !ok {
+			return fmt.Errorf("invalid validator power: %v", val["power"])
+		}
+
+		// Voting power is an integer, round down while keeping validators
+		// with some power from dropping out of the set.
+		power.Mul(power, factor)
+		scaled := new(big.Int).Quo(power.Num(), power.Denom())
+		if scaled.Sign() == 0 {
+			scaled.SetInt64(1)
+		}
+		val["power"] = scaled.String()
+	}
+	return nil
+}
+
+func setUnbondingTime(g map[string]interface{}, value string) error {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+
+	params, err := lookupMap(g, "app_state", "staking", "params")
+	if err != nil {
+		return err
+	}
+	params["unbonding_time"] = fmt.Sprintf("%.0fs", d.Seconds())
+	return nil
+}
+
+func lookupMap(g map[string]interface{}, path ...string) (map[string]interface{}, error) {
+	m := g
+	for i, key := range path {
+		next, ok := m[key].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%v not found", path[:i+1])
+		}
+		m = next
+	}
+	return m, nil
+}
@@ -0,0 +1,81 @@
+package genesis_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+	"github.com/allinbits/runsim-operator/internal/genesis"
+)
+
+const testGenesis = `{
+  "chain_id": "cosmoshub-4",
+  "validators": [{"name": "a", "power": "10"}, {"name": "b", "power": "3"}],
+  "app_state": {"staking": {"params": {"unbonding_time": "1814400s", "max_validators": 125}}}
+}`
+
+func TestApplyPatches(t *testing.T) {
+	patched, err := genesis.ApplyPatches([]byte(testGenesis), []toolsv1.GenesisPatch{
+		{Type: toolsv1.SetChainId, Value: "simulation-1"},
+		{Type: toolsv1.ScaleVotingPower, Value: "0.25"},
+		{Type: toolsv1.SetUnbondingTime, Value: "10m"},
+		{Type: toolsv1.MergePatch, Patch: `{"app_state": {"staking": {"params": {"max_validators": 10}}}}`},
+		{Type: toolsv1.JSONPatch, Patch: `[{"op": "remove", "path": "/validators/1/name"}]`},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var g struct {
+		ChainId    string `json:"chain_id"`
+		Validators []struct {
+			Name  string `json:"name"`
+			Power string `json:"power"`
+		} `json:"validators"`
+		AppState struct {
+			Staking struct {
+				Params struct {
+					UnbondingTime string `json:"unbonding_time"`
+					MaxValidators int    `json:"max_validators"`
+				} `json:"params"`
+			} `json:"staking"`
+		} `json:"app_state"`
+	}
+	if err := json.Unmarshal(patched, &g); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if g.ChainId != "simulation-1" {
+		t.Fatalf("wanted chain_id simulation-1, got %q", g.ChainId)
+	}
+
+	if g.Validators[0].Power != "2" || g.Validators[1].Power != "1" {
+		t.Fatalf("wanted powers 2 and 1, got %q and %q", g.Validators[0].Power, g.Validators[1].Power)
+	}
+
+	if g.Validators[1].Name != "" {
+		t.Fatalf("wanted name removed, got %q", g.Validators[1].Name)
+	}
+
+	if g.AppState.Staking.Params.UnbondingTime != "600s" {
+		t.Fatalf("wanted unbonding_time 600s, got %q", g.AppState.Staking.Params.UnbondingTime)
+	}
+
+	if g.AppState.Staking.Params.MaxValidators != 10 {
+		t.Fatalf("wanted max_validators 10, got %d", g.AppState.Staking.Params.MaxValidators)
+	}
+}
+
+func TestApplyPatchesErrors(t *testing.T) {
+	for _, p := range []toolsv1.GenesisPatch{
+		{Type: "unknown"},
+		{Type: toolsv1.SetChainId},
+		{Type: toolsv1.ScaleVotingPower, Value: "-1"},
+		{Type: toolsv1.SetUnbondingTime, Value: "forever"},
+		{Type: toolsv1.JSONPatch, Patch: `[{"op": "remove", "path": "/missing"}]`},
+	} {
+		if _, err := genesis.ApplyPatches([]byte(testGenesis), []toolsv1.GenesisPatch{p}); err == nil {
+			t.Fatalf("wanted error for patch %+v", p)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Package s3 provides access to S3 compatible object stores, shared between
+// the operator and the tools run inside simulation pods.
+package s3
+
+import (
+	"strconv"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+
+	"github.com/allinbits/runsim-operator/internal/environ"
+)
+
+// Environment used to configure access to the bucket.
+const (
+	EndpointEnv        = "MINIO_ENDPOINT"
+	BucketNameEnv      = "MINIO_BUCKET_NAME"
+	RegionEnv          = "S3_REGION"
+	InsecureEnv        = "S3_INSECURE"
+	PathStyleEnv       = "S3_PATH_STYLE"
+	AccessKeyIdEnv     = "S3_ACCESS_KEY_ID"
+	SecretAccessKeyEnv = "S3_SECRET_ACCESS_KEY"
+)
+
+// Config specifies how to access a bucket.
+type Config struct {
+	Endpoint        string
+	Bucket          string
+	Region          string
+	AccessKeyId     string
+	SecretAccessKey string
+
+	// Insecure disables TLS, e.g. for MinIO running inside the cluster.
+	Insecure bool
+
+	// PathStyle forces path-style requests instead of virtual-host-style.
+	PathStyle bool
+}
+
+// NewClient returns a client for the configured endpoint.
+func NewClient(cfg Config) (*minio.Client, error) {
+	lookup := minio.BucketLookupAuto
+	if cfg.PathStyle {
+		lookup = minio.BucketLookupPath
+	}
+
+	// Without static credentials, those of the environment are used, e.g.
+	// web identity tokens of IAM roles for service accounts.
+	creds := credentials.NewStaticV4(cfg.AccessKeyId, cfg.SecretAccessKey, "")
+	if cfg.AccessKeyId == "" {
+		creds = credentials.NewIAM("")
+	}
+
+	return minio.New(cfg.Endpoint, &minio.Options{
+		Creds:        creds,
+		Secure:       !cfg.Insecure,
+		Region:       cfg.Region,
+		BucketLookup: lookup,
+	})
+}
+
+// Env returns the environment providing this configuration to ConfigFromEnv.
+func (cfg Config) Env() map[string]string {
+	return map[string]string{
+		EndpointEnv:        cfg.Endpoint,
+		BucketNameEnv:      cfg.Bucket,
+		RegionEnv:          cfg.Region,
+		InsecureEnv:        strconv.FormatBool(cfg.Insecure),
+		PathStyleEnv:       strconv.FormatBool(cfg.PathStyle),
+		AccessKeyIdEnv:     cfg.AccessKeyId,
+		SecretAccessKeyEnv: cfg.SecretAccessKey,
+	}
+}
+
+// ConfigFromEnv returns the configuration provided in the environment.
+func ConfigFromEnv() Config {
+	return Config{
+		Endpoint:        environ.GetString(EndpointEnv, ""),
+		Bucket:          environ.GetString(BucketNameEnv, ""),
+		Region:          environ.GetString(RegionEnv, ""),
+		AccessKeyId:     environ.GetString(AccessKeyIdEnv, ""),
+		SecretAccessKey: environ.GetString(SecretAccessKeyEnv, ""),
+		Insecure:        environ.GetBool(InsecureEnv, false),
+		PathStyle:       environ.GetBool(PathStyleEnv, false),
+	}
+}
@@ -0,0 +1,198 @@
+package tools
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+
+	"github.com/allinbits/runsim-operator/internal/environ"
+	"github.com/allinbits/runsim-operator/internal/s3"
+)
+
+const (
+	UploadArtifactsCommand = "upload-artifacts"
+
+	// ArtifactStoreEnv specifies the store to upload artifacts to, either
+	// S3Store, configured as in s3.ConfigFromEnv, or FilesystemStore.
+	ArtifactStoreEnv = "ARTIFACT_STORE"
+	// ArtifactsDirEnv specifies the directory to upload artifacts to for FilesystemStore.
+	ArtifactsDirEnv = "ARTIFACTS_DIR"
+
+	S3Store         = "s3"
+	FilesystemStore = "filesystem"
+)
+
+// uploadArtifacts uploads the files given as name=path arguments, gzip
+// compressed, to <prefix>/<name>.gz, or as they are to <prefix>/<name> with
+// -compressed. Files that do not exist are skipped.
+func uploadArtifacts(args []string) error {
+	var prefix, contentType string
+	var compressed bool
+	metadata := make(metadataFlag)
+
+	fs := flag.NewFlagSet(UploadArtifactsCommand, flag.ContinueOnError)
+	fs.StringVar(&prefix, "prefix", "", "prefix of the uploaded objects")
+	fs.StringVar(&contentType, "content-type", "application/json", "content type of the uploaded files")
+	fs.BoolVar(&compressed, "compressed", false, "whether the files are already compressed, such as pprof profiles")
+	fs.Var(metadata, "metadata", "key=value metadata stored with the uploaded objects, can be repeated")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	encoding := "gzip"
+	if compressed {
+		// Files stored as they are must not be decompressed on download
+		encoding = ""
+	}
+	put, err := newPutFunc(contentType, encoding)
+	if err != nil {
+		return err
+	}
+
+	for _, arg := range fs.Args() {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid artifact %q, expected name=path", arg)
+		}
+		name, p := parts[0], parts[1]
+
+		f, err := os.Open(p)
+		if os.IsNotExist(err) {
+			fmt.Printf("skipping %s: %s does not exist\n", name, p)
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		key, r := fmt.Sprintf("%s/%s", prefix, name), io.Reader(f)
+		if !compressed {
+			key, r = key+".gz", compress(f)
+		}
+		err = put(key, r, metadata)
+		_ = f.Close()
+		if err != nil {
+			return fmt.Errorf("error uploading %s: %v", name, err)
+		}
+		fmt.Printf("uploaded %s to %s\n", name, key)
+	}
+	return nil
+}
+
+type putFunc func(key string, r io.Reader, metadata map[string]string) error
+
+// metadataFlag collects repeated key=value flags.
+type metadataFlag map[string]string
+
+func (m metadataFlag) String() string {
+	return fmt.Sprint(map[string]string(m))
+}
+
+func (m metadataFlag) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid metadata %q, expected key=value", value)
+	}
+	m[strings.ToLower(parts[0])] = parts[1]
+	return nil
+}
+
+// MetadataPath returns the path of the hidden file holding the metadata of
+// the object stored at p, for FilesystemStore.
+func MetadataPath(p string) string {
+	return filepath.Join(filepath.Dir(p), "."+filepath.Base(p)+".meta")
+}
+
+// newPutFunc returns a function storing objects in the artifact store
+// configured in the environment, with the given content encoding.
+func newPutFunc(contentType, contentEncoding string) (putFunc, error) {
+	switch store := environ.GetString(ArtifactStoreEnv, S3Store); store {
+	case S3Store:
+		cfg := s3.ConfigFromEnv()
+		client, err := s3.NewClient(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return func(key string, r io.Reader, metadata map[string]string) error {
+			_, err := client.PutObject(context.Background(), cfg.Bucket, key, r, -1, minio.PutObjectOptions{
+				ContentType:     contentType,
+				ContentEncoding: contentEncoding,
+				UserMetadata:    metadata,
+			})
+			return err
+		}, nil
+
+	case FilesystemStore:
+		dir := environ.GetString(ArtifactsDirEnv, "")
+		return func(key string, r io.Reader, metadata map[string]string) error {
+			return WriteFileObject(filepath.Join(dir, filepath.FromSlash(path.Clean("/"+key))), r, metadata)
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported artifact store %q", store)
+	}
+}
+
+// WriteFileObject stores the object at p for FilesystemStore, along with its
+// metadata. Metadata is written first, so an object is never seen with stale
+// metadata.
+func WriteFileObject(p string, r io.Reader, metadata map[string]string) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+
+	if len(metadata) > 0 {
+		b, err := json.Marshal(metadata)
+		if err != nil {
+			return err
+		}
+		if err := writeFile(MetadataPath(p), bytes.NewReader(b)); err != nil {
+			return err
+		}
+	} else if err := os.Remove(MetadataPath(p)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return writeFile(p, r)
+}
+
+// writeFile writes to a temporary file first so that readers never see
+// partial objects.
+func writeFile(p string, r io.Reader) error {
+	f, err := ioutil.TempFile(filepath.Dir(p), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := io.Copy(f, r); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
+
+// compress returns a reader with the gzip compressed contents of r.
+func compress(r io.Reader) io.Reader {
+	pr, pw := io.Pipe()
+	go func() {
+		gz := gzip.NewWriter(pw)
+		_, err := io.Copy(gz, r)
+		if err == nil {
+			err = gz.Close()
+		}
+		_ = pw.CloseWithError(err)
+	}()
+	return pr
+}
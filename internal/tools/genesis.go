@@ -0,0 +1,63 @@
+package tools
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
+	"github.com/allinbits/runsim-operator/internal/environ"
+	"github.com/allinbits/runsim-operator/internal/genesis"
+)
+
+const (
+	PatchGenesisCommand = "patch-genesis"
+
+	// GenesisPatchesEnv holds the json encoded list of patches to apply.
+	GenesisPatchesEnv = "GENESIS_PATCHES"
+)
+
+func patchGenesis(args []string) error {
+	var in, out string
+
+	fs := flag.NewFlagSet(PatchGenesisCommand, flag.ContinueOnError)
+	fs.StringVar(&in, "in", "", "path of the genesis to patch")
+	fs.StringVar(&out, "out", "", "path to write the patched genesis to")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if in == "" || out == "" {
+		return fmt.Errorf("both -in and -out are required")
+	}
+
+	var patches []toolsv1.GenesisPatch
+	if err := json.Unmarshal([]byte(environ.GetString(GenesisPatchesEnv, "[]")), &patches); err != nil {
+		return fmt.Errorf("invalid %s: %v", GenesisPatchesEnv, err)
+	}
+
+	doc, err := ioutil.ReadFile(in)
+	if err != nil {
+		return err
+	}
+
+	patched, err := genesis.ApplyPatches(doc, patches)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(out, patched, 0644); err != nil {
+		return err
+	}
+
+	fmt.Printf("applied %d patches, sha256: %x\n", len(patches), sha256.Sum256(patched))
+	return nil
+}
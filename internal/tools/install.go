@@ -0,0 +1,39 @@
+package tools
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+const InstallCommand = "install"
+
+// install copies this binary to the given path, so that tools can be run from
+// containers using other images.
+func install(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s <path>", InstallCommand)
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	in, err := os.Open(self)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(args[0], os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,186 @@
+package tools
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"github.com/allinbits/runsim-operator/internal/environ"
+	"github.com/allinbits/runsim-operator/internal/s3"
+)
+
+const (
+	DownloadStateCommand = "download-state"
+
+	// DefaultChainID is the chain id used by simulations.
+	DefaultChainID = "simulation-app"
+
+	// StateNotFoundExitCode is the exit code of download-state when there is
+	// no state stored under the key, e.g. because it was not exported.
+	StateNotFoundExitCode = 3
+)
+
+// errNotFound is returned by getFunc when there is no object stored under key.
+var errNotFound = errors.New("not found")
+
+// downloadState downloads the gzip compressed app state exported by a
+// simulation, uploaded with upload-artifacts, and writes it as a genesis
+// document to be run by another simulation.
+func downloadState(args []string) error {
+	var key, out, chainID string
+
+	fs := flag.NewFlagSet(DownloadStateCommand, flag.ContinueOnError)
+	fs.StringVar(&key, "key", "", "key of the exported state")
+	fs.StringVar(&out, "out", "", "path to write the genesis to")
+	fs.StringVar(&chainID, "chain-id", DefaultChainID, "chain id of the genesis")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if key == "" || out == "" {
+		return fmt.Errorf("both -key and -out are required")
+	}
+
+	get, err := newGetFunc()
+	if err != nil {
+		return err
+	}
+
+	r, exported, err := get(key)
+	if err == errNotFound {
+		return &exitError{err: fmt.Errorf("no state stored under %s", key), code: StateNotFoundExitCode}
+	} else if err != nil {
+		return fmt.Errorf("error downloading %s: %v", key, err)
+	}
+	defer r.Close()
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+
+	// The chain continues from the time the state was exported
+	header, err := json.Marshal(struct {
+		GenesisTime time.Time `json:"genesis_time"`
+		ChainID     string    `json:"chain_id"`
+	}{exported.UTC(), chainID})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// The state is streamed into the genesis as it may not fit in memory
+	w := bufio.NewWriter(f)
+	w.Write(header[:len(header)-1])
+	w.WriteString(`,"app_state":`)
+	if err := copyJSON(w, gz); err != nil {
+		return fmt.Errorf("invalid state in %s: %v", key, err)
+	}
+	w.WriteString("}\n")
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("wrote genesis from %s to %s\n", key, out)
+	return nil
+}
+
+// copyJSON copies a single JSON value from r to w, returning an error if it
+// is not valid.
+func copyJSON(w io.Writer, r io.Reader) error {
+	dec := json.NewDecoder(io.TeeReader(r, w))
+	for depth := 0; ; {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		} else if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			break
+		}
+	}
+	if dec.More() {
+		return fmt.Errorf("unexpected data after the value")
+	}
+	return nil
+}
+
+// getFunc returns the object stored under key and when it was stored.
+type getFunc func(key string) (io.ReadCloser, time.Time, error)
+
+// newGetFunc returns a function reading objects from the artifact store
+// configured in the environment.
+func newGetFunc() (getFunc, error) {
+	switch store := environ.GetString(ArtifactStoreEnv, S3Store); store {
+	case S3Store:
+		cfg := s3.ConfigFromEnv()
+		client, err := s3.NewClient(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return func(key string) (io.ReadCloser, time.Time, error) {
+			obj, err := client.GetObject(context.Background(), cfg.Bucket, key, minio.GetObjectOptions{})
+			if err != nil {
+				return nil, time.Time{}, err
+			}
+			info, err := obj.Stat()
+			if err != nil {
+				obj.Close()
+				if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+					return nil, time.Time{}, errNotFound
+				}
+				return nil, time.Time{}, err
+			}
+			return obj, info.LastModified, nil
+		}, nil
+
+	case FilesystemStore:
+		dir := environ.GetString(ArtifactsDirEnv, "")
+		return func(key string) (io.ReadCloser, time.Time, error) {
+			f, err := os.Open(filepath.Join(dir, filepath.FromSlash(path.Clean("/"+key))))
+			if os.IsNotExist(err) {
+				return nil, time.Time{}, errNotFound
+			} else if err != nil {
+				return nil, time.Time{}, err
+			}
+			info, err := f.Stat()
+			if err != nil {
+				f.Close()
+				return nil, time.Time{}, err
+			}
+			return f, info.ModTime(), nil
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported artifact store %q", store)
+	}
+}
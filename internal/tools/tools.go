@@ -0,0 +1,55 @@
+// Package tools implements the commands run by the operator binary inside
+// simulation pods, e.g. to prepare the genesis before the simulation starts
+// or to upload the files it produces.
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+type command func(args []string) error
+
+// exitError is returned by commands exiting with a specific code, telling
+// their failures apart.
+type exitError struct {
+	err  error
+	code int
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+var commands = map[string]command{
+	PatchGenesisCommand:    patchGenesis,
+	InstallCommand:         install,
+	UploadArtifactsCommand: uploadArtifacts,
+	DownloadStateCommand:   downloadState,
+}
+
+// IsCommand returns whether name is a tools command.
+func IsCommand(name string) bool {
+	_, ok := commands[name]
+	return ok
+}
+
+// Run runs the tools command specified in args[0] and returns the exit code.
+func Run(args []string) int {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", args[0])
+		return 2
+	}
+
+	if err := cmd(args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+		var exit *exitError
+		if errors.As(err, &exit) {
+			return exit.code
+		}
+		return 1
+	}
+	return 0
+}
@@ -19,6 +19,7 @@ package main
 import (
 	"flag"
 	"os"
+	"time"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
@@ -29,6 +30,7 @@ import (
 	toolsv1 "github.com/allinbits/runsim-operator/api/v1"
 	"github.com/allinbits/runsim-operator/controllers/simulation"
 	"github.com/allinbits/runsim-operator/internal/environ"
+	"github.com/allinbits/runsim-operator/internal/tools"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -38,12 +40,21 @@ var (
 	metricsAddr          string
 	enableLeaderElection bool
 
+	artifactStore   string
 	minioEndpoint   string
 	minioBucketName string
+	s3Region        string
+	s3Insecure      bool
+	s3PathStyle     bool
 	s3AccessKeyID   string
 	s3AccessSecret  string
+	artifactsDir    string
+	artifactsPVC    string
+
+	orphanedArtifactsDays int
 
 	imagePullSecret string
+	toolsImage      string
 )
 
 func init() {
@@ -55,14 +66,27 @@ func init() {
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false, "Enable leader election for controller manager")
 
-	flag.StringVar(&minioEndpoint, "minio-endpoint", environ.GetString("MINIO_ENDPOINT", simulation.DefaultMinioEndpoint), "endpoint for minio (only s3 supported)")
+	flag.StringVar(&artifactStore, "artifact-store", environ.GetString("ARTIFACT_STORE", simulation.DefaultArtifactStore), "where to store simulation logs and artifacts (s3, filesystem or memory)")
+	flag.StringVar(&minioEndpoint, "minio-endpoint", environ.GetString("MINIO_ENDPOINT", simulation.DefaultMinioEndpoint), "endpoint for minio (any s3 compatible endpoint)")
 	flag.StringVar(&minioBucketName, "minio-bucket-name", environ.GetString("MINIO_BUCKET_NAME", simulation.DefaultLogsBucketName), "minio bucket name")
+	flag.StringVar(&s3Region, "s3-region", environ.GetString("S3_REGION", ""), "s3 region of the bucket (for minio)")
+	flag.BoolVar(&s3Insecure, "s3-insecure", environ.GetBool("S3_INSECURE", false), "disable TLS when connecting to the s3 endpoint (for minio)")
+	flag.BoolVar(&s3PathStyle, "s3-path-style", environ.GetBool("S3_PATH_STYLE", false), "use path-style requests to the s3 endpoint (for minio)")
 	flag.StringVar(&s3AccessKeyID, "s3-access-key-id", environ.GetString("S3_ACCESS_KEY_ID", ""), "aws s3 access key id (for minio)")
 	flag.StringVar(&s3AccessSecret, "s3-secret-access-key", environ.GetString("S3_SECRET_ACCESS_KEY", ""), "aws s3 secret access key (for minio)")
+	flag.StringVar(&artifactsDir, "artifacts-dir", environ.GetString("ARTIFACTS_DIR", simulation.DefaultArtifactsDir), "directory to store artifacts in (for filesystem)")
+	flag.StringVar(&artifactsPVC, "artifacts-pvc", environ.GetString("ARTIFACTS_PVC", ""), "name of the pvc mounted in artifacts-dir, mounted by simulation pods to upload artifacts (for filesystem)")
 	flag.StringVar(&imagePullSecret, "image-pull-secret", environ.GetString("IMAGE_PULL_SECRET", ""), "name of secret with credentials for pulling docker images")
+	flag.IntVar(&orphanedArtifactsDays, "orphaned-artifacts-retention-days", environ.GetInt("ORPHANED_ARTIFACTS_RETENTION_DAYS", 0), "days after which the artifacts of simulations that no longer exist are deleted (0 keeps them forever)")
+	flag.StringVar(&toolsImage, "tools-image", environ.GetString("TOOLS_IMAGE", simulation.DefaultToolsImage), "image of this operator, used to run tools inside simulation pods")
 }
 
 func main() {
+	// The operator binary also provides the tools run inside simulation pods
+	if len(os.Args) > 1 && tools.IsCommand(os.Args[1]) {
+		os.Exit(tools.Run(os.Args[1:]))
+	}
+
 	flag.Parse()
 
 	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
@@ -81,11 +105,19 @@ func main() {
 
 	if err := simulation.SetupSimulationReconciler(mgr,
 		simulation.EnableLogBackups(true),
+		simulation.WithArtifactStore(artifactStore),
 		simulation.MinioEndpoint(minioEndpoint),
 		simulation.LogsBucketName(minioBucketName),
+		simulation.S3Region(s3Region),
+		simulation.S3Insecure(s3Insecure),
+		simulation.S3PathStyle(s3PathStyle),
 		simulation.S3AccessKeyId(s3AccessKeyID),
 		simulation.S3SecretAccessKey(s3AccessSecret),
+		simulation.ArtifactsDir(artifactsDir),
+		simulation.ArtifactsPVC(artifactsPVC),
 		simulation.WithImagePullSecret(imagePullSecret),
+		simulation.WithToolsImage(toolsImage),
+		simulation.WithOrphanedArtifactsRetention(time.Duration(orphanedArtifactsDays)*24*time.Hour),
 	); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Simulations")
 		os.Exit(1)